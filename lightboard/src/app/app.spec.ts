@@ -4,7 +4,7 @@ import { DOCUMENT } from '@angular/common';
 import { App } from './app';
 import { By } from '@angular/platform-browser';
 import { ChannelSettingsService, AppSettings } from './channel-settings.service';
-import { HttpDataService, CombinedOutputData } from './http-data.service';
+import { HttpDataService, CombinedOutputData, PostResponse } from './http-data.service';
 import { ThemeService } from './theme.service'; // Import ThemeService
 import { BehaviorSubject, of } from 'rxjs';
 // import { map } from 'rxjs/operators'; // Removed unused import
@@ -81,7 +81,7 @@ describe('App', () => {
     // mockChannelSettingsService.getDarkMode.and.returnValue(appSettingsSubject.pipe(map(s => s.darkMode))); // Removed
 
     mockHttpDataService = jasmine.createSpyObj('HttpDataService', ['postCombinedOutput']);
-    mockHttpDataService.postCombinedOutput.and.returnValue(of({success: true}));
+    mockHttpDataService.postCombinedOutput.and.returnValue(of({ status: 'ok', summary: { total: 0, processed: 0, confirmed: 0, sent: 0, queued: 0, unchanged: 0, failed: 0, rejected: 0 } } as PostResponse));
 
     mockRenderer = jasmine.createSpyObj('Renderer2', ['addClass', 'removeClass', 'listen']);
     mockRenderer.listen.and.returnValue(() => { /* mock listener */ });
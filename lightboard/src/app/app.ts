@@ -123,7 +123,10 @@ export class App implements OnInit, OnDestroy {
         this.row2States = this.row2States.map((state, index) => { if(state.channelDescription !== (newDescriptions[index] || `Channel ${index + 1}`)) { descriptionsActuallyChanged = true; } return { ...state, channelDescription: newDescriptions[index] || `Channel ${index + 1}` }; });
         if(descriptionsActuallyChanged) channelsOrDescriptionsChanged = true;
       }
-      this.currentBackendUrl = settings.backendUrl;
+      if (this.currentBackendUrl !== settings.backendUrl) {
+        this.currentBackendUrl = settings.backendUrl;
+        this.fetchServerChannelCount();
+      }
       // Update displayCrossfadeDurationSeconds if it changed in settings (e.g., due to reset)
       // This will also update currentCrossfadeDurationMs via its setter or direct update.
       if (this.displayCrossfadeDurationSeconds !== settings.crossfadeDurationSeconds) {
@@ -137,6 +140,7 @@ export class App implements OnInit, OnDestroy {
       if (channelsOrDescriptionsChanged) { this.calculateCombinedOutputs(); }
       this.cdr.detectChanges();
     });
+    this.fetchServerChannelCount();
 
     // ThemeService subscription to apply body class (alternative to direct renderer call in service)
     // However, ThemeService already handles applying the class directly via Renderer2.
@@ -332,12 +336,25 @@ export class App implements OnInit, OnDestroy {
     return this.isShiftPressed ? (naturalTargetValue === 0 ? 100 : 0) : naturalTargetValue;
   }
 
+  // Asks the server how many channels it has mapped, which bounds the number of channels in the settings
+  private fetchServerChannelCount(): void {
+    if (!this.currentBackendUrl) {
+      return;
+    }
+    this.httpDataService.getChannelSummary(this.currentBackendUrl).subscribe({
+      next: (summary) => { this.channelSettingsService.setMaxChannels(summary.maxChannelNumber); },
+      error: (err) => { console.error('Error fetching the channel count:', err); }
+    });
+  }
+
   // Renamed from onPotentiometerChange
   updateAudioEngineAndPostData(): void {
     this.calculateCombinedOutputs();
     if (this.currentBackendUrl && this.combinedOutputStates && this.combinedOutputStates.length > 0) {
       this.httpDataService.postCombinedOutput(this.currentBackendUrl, this.combinedOutputStates as CombinedOutputData[]).subscribe({
-        next: () => { /* Handle successful post if needed */ },
+        next: (response) => {
+          if (response?.status === 'error') { console.warn('Some channels were not delivered:', response.errors); }
+        },
         error: (err) => { console.error('Error posting data:', err); }
       });
     }
@@ -94,6 +94,26 @@ describe('ChannelSettingsService', () => {
           done();
         });
       });
+
+    it('updateNumChannels should reject counts above the server channel count', () => {
+        expect(service.getCurrentMaxChannels()).toBe(12);
+        service.updateNumChannels(24);
+        expect(service.getCurrentNumChannels()).toBe(defaultNumChannels);
+
+        service.setMaxChannels(24);
+        service.updateNumChannels(24);
+        expect(service.getCurrentNumChannels()).toBe(24);
+        expect(service.getCurrentChannelDescriptions().length).toBe(24);
+      });
+
+    it('setMaxChannels should drop channels the server does not have and be remembered', () => {
+        service.setMaxChannels(2);
+        expect(service.getCurrentNumChannels()).toBe(2);
+        expect(localStorage.setItem).toHaveBeenCalledWith('maxChannels_v1', '2');
+
+        const reloaded = new ChannelSettingsService();
+        expect(reloaded.getCurrentMaxChannels()).toBe(2);
+      });
   });
 
   it('resetToDefaults should reset all settings (darkMode is not part of this service anymore)', (done) => {
@@ -25,11 +25,14 @@ export interface ChannelConfig {
 export class ChannelSettingsService {
   // localStorage Keys
   private settingsKey = 'appSettings_v1';
+  private maxChannelsKey = 'maxChannels_v1';
 
   // Default values
   private readonly defaultNumChannels = 4;
   private readonly defaultBackendUrl = '';
   private readonly defaultCrossfadeDurationSeconds = 0.5;
+  // Used until the server reports how many channels it has mapped
+  private readonly defaultMaxChannels = 12;
   // private readonly defaultDarkMode = false; // Removed
 
   private getDefaultDescriptions(count: number): string[] {
@@ -37,12 +40,26 @@ export class ChannelSettingsService {
   }
 
   private appSettingsSubject: BehaviorSubject<AppSettings>;
+  private maxChannelsSubject: BehaviorSubject<number>;
 
   constructor() {
+    this.maxChannelsSubject = new BehaviorSubject<number>(this.loadMaxChannels());
     const loadedSettings = this.loadSettings();
     this.appSettingsSubject = new BehaviorSubject<AppSettings>(loadedSettings);
   }
 
+  private loadMaxChannels(): number {
+    try {
+      const storedMaxChannels = Number(localStorage.getItem(this.maxChannelsKey));
+      if (Number.isInteger(storedMaxChannels) && storedMaxChannels >= 1) {
+        return storedMaxChannels;
+      }
+    } catch {
+      // console.error('ChannelSettingsService: Error loading max channels from localStorage', error);
+    }
+    return this.defaultMaxChannels;
+  }
+
   private loadSettings(): AppSettings {
     try {
       const storedSettingsJson = localStorage.getItem(this.settingsKey);
@@ -50,7 +67,7 @@ export class ChannelSettingsService {
         const storedSettings = JSON.parse(storedSettingsJson) as Partial<AppSettings>;
 
         let numChannels = storedSettings.numChannels ?? this.defaultNumChannels;
-        if (typeof numChannels !== 'number' || numChannels < 1 || numChannels > 12) {
+        if (typeof numChannels !== 'number' || numChannels < 1 || numChannels > this.getCurrentMaxChannels()) {
           numChannels = this.defaultNumChannels;
         }
 
@@ -148,6 +165,14 @@ export class ChannelSettingsService {
     return this.appSettingsSubject.getValue().crossfadeDurationSeconds;
   }
 
+  // Highest channel number the server has mapped, as reported by GET /channels
+  public getMaxChannels(): Observable<number> {
+    return this.maxChannelsSubject.asObservable();
+  }
+  public getCurrentMaxChannels(): number {
+    return this.maxChannelsSubject.getValue();
+  }
+
   // public getDarkMode(): Observable<boolean> { // Removed
   //   return this.appSettingsSubject.pipe(map(settings => settings.darkMode));
   // }
@@ -156,7 +181,7 @@ export class ChannelSettingsService {
   // }
 
   public updateNumChannels(newCount: number): void {
-    if (typeof newCount !== 'number' || newCount < 1 || newCount > 12) {
+    if (typeof newCount !== 'number' || newCount < 1 || newCount > this.getCurrentMaxChannels()) {
       return;
     }
     const currentSettings = this.appSettingsSubject.getValue();
@@ -212,6 +237,22 @@ export class ChannelSettingsService {
     this.appSettingsSubject.next(newSettings);
   }
 
+  // Called with the server's channel count; channels beyond it are dropped
+  public setMaxChannels(newMax: number): void {
+    if (!Number.isInteger(newMax) || newMax < 1 || newMax === this.getCurrentMaxChannels()) {
+      return;
+    }
+    try {
+      localStorage.setItem(this.maxChannelsKey, String(newMax));
+    } catch {
+      // console.error('ChannelSettingsService: Error saving max channels to localStorage', error);
+    }
+    this.maxChannelsSubject.next(newMax);
+    if (this.getCurrentNumChannels() > newMax) {
+      this.updateNumChannels(newMax);
+    }
+  }
+
   // public updateDarkMode(isDarkMode: boolean): void { // Removed
   //   if (typeof isDarkMode !== 'boolean') return;
   //   const currentSettings = this.appSettingsSubject.getValue();
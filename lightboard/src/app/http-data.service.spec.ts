@@ -1,6 +1,6 @@
 import { TestBed } from '@angular/core/testing';
 import { HttpClientTestingModule, HttpTestingController } from '@angular/common/http/testing';
-import { HttpDataService, CombinedOutputData } from './http-data.service';
+import { HttpDataService, CombinedOutputData, PostResponse } from './http-data.service';
 
 describe('HttpDataService', () => {
   let service: HttpDataService;
@@ -26,7 +26,11 @@ describe('HttpDataService', () => {
   it('should POST combined output data to the specified URL', () => {
     const testUrl = 'https://example.com/api/data';
     const testData: CombinedOutputData[] = [{ channelNumber: 1, channelDescription: 'Test', value: 50, color: '#ff0000' }];
-    const mockResponse = { success: true };
+    const mockResponse: PostResponse = {
+      status: 'ok',
+      summary: { total: 1, processed: 1, confirmed: 0, sent: 1, queued: 0, unchanged: 0, failed: 0, rejected: 0 },
+      results: [{ index: 0, channelNumber: 1, status: 'sent', topics: ['ch1/intensity', 'ch1/color', 'ch1/onoff'] }]
+    };
 
     service.postCombinedOutput(testUrl, testData).subscribe(response => {
       expect(response).toEqual(mockResponse);
@@ -65,4 +69,52 @@ describe('HttpDataService', () => {
     expect(req.request.method).toBe('POST');
     req.flush(errorMessage, { status: 403, statusText: 'Forbidden' });
   });
+
+  it('should include the server\'s error messages when a request is refused', (done) => {
+    const testUrl = 'https://example.com/api/data';
+    const errorBody = { status: 'error', code: 'empty_request', summary: {}, errors: ['Received empty data array'] };
+
+    service.postCombinedOutput(testUrl, []).subscribe({
+        next: () => fail('should have failed with an HTTP error'),
+        error: (error) => {
+            expect(error.message).toBe('Error posting data: Bad Request (Status: 400): Received empty data array');
+            done();
+        }
+    });
+
+    const req = httpMock.expectOne(testUrl);
+    req.flush(errorBody, { status: 400, statusText: 'Bad Request' });
+  });
+
+  it('should pass on partial deliveries with their per-channel results', () => {
+    const testUrl = 'https://example.com/api/data';
+    const testData: CombinedOutputData[] = [{ channelNumber: 1, channelDescription: 'Test', value: 50, color: '#ff0000' }];
+    const mockResponse = {
+      status: 'error',
+      summary: { total: 1, processed: 0, confirmed: 0, sent: 0, queued: 0, unchanged: 0, failed: 0, rejected: 1 },
+      errors: ['No topic mapping found for channelNumber: 1'],
+      results: [{ index: 0, channelNumber: 1, status: 'rejected', code: 'unknown_channel', errors: ['No topic mapping found for channelNumber: 1'] }]
+    };
+
+    service.postCombinedOutput(testUrl, testData).subscribe(response => {
+      expect(response.status).toBe('error');
+      expect(response.results?.[0].code).toBe('unknown_channel');
+    });
+
+    const req = httpMock.expectOne(testUrl);
+    req.flush(mockResponse, { status: 207, statusText: 'Multi-Status' });
+  });
+
+  it('should GET the channel count next to the backend URL without an API token', () => {
+    const mockSummary = { channelCount: 2, maxChannelNumber: 24 };
+
+    service.getChannelSummary('ws://bridge.local:8080/ws').subscribe(summary => {
+      expect(summary.maxChannelNumber).toBe(24);
+    });
+
+    const req = httpMock.expectOne('http://bridge.local:8080/channels');
+    expect(req.request.method).toBe('GET');
+    expect(req.request.headers.has('Authorization')).toBeFalse();
+    req.flush(mockSummary);
+  });
 });
@@ -11,6 +11,40 @@ export interface CombinedOutputData {
   // Add any other relevant fields that might be part of combinedOutputStates
 }
 
+// Outcome of one posted channel, as reported by the server's /post endpoint
+export interface DataPointResult {
+  index: number;
+  channelNumber: number;
+  status: 'confirmed' | 'sent' | 'queued' | 'unchanged' | 'failed' | 'rejected';
+  code?: string; // Why the channel was rejected or failed, e.g. 'unknown_channel'
+  errors?: string[];
+  topics?: string[];
+}
+
+// Response of the server's /post endpoint
+export interface PostResponse {
+  status: 'ok' | 'error';
+  code?: string; // Set when the whole request was refused
+  summary: {
+    total: number;
+    processed: number;
+    confirmed: number;
+    sent: number;
+    queued: number;
+    unchanged: number;
+    failed: number;
+    rejected: number;
+  };
+  errors?: string[];
+  results?: DataPointResult[];
+}
+
+// Response of the server's GET /channels, which needs no API token
+export interface ChannelSummary {
+  channelCount: number;
+  maxChannelNumber: number; // Highest mapped channel number, i.e. how many channels to show
+}
+
 @Injectable({
   providedIn: 'root'
 })
@@ -18,14 +52,16 @@ export class HttpDataService {
   private http = inject(HttpClient);
 
 
-  postCombinedOutput(url: string, data: CombinedOutputData[]): Observable<unknown> {
+  // Resolves with the server's response even if some channels were not delivered (207);
+  // check its status and results. Errors are only raised for refused requests.
+  postCombinedOutput(url: string, data: CombinedOutputData[]): Observable<PostResponse> {
     if (!url) {
       // console.warn('HttpDataService: Backend URL is not configured. Skipping POST.');
       return throwError(() => new Error('Backend URL not configured.')); // Or return of(null) or EMPTY if you don't want an error
     }
 
     // console.log('HttpDataService: Posting to', url, data); // For debugging
-    return this.http.post<unknown>(url, data).pipe(
+    return this.http.post<PostResponse>(url, data).pipe(
       tap(() => { // Removed unused 'response'
         // console.log('HttpDataService: Successfully posted data.');
       }),
@@ -33,7 +69,26 @@ export class HttpDataService {
         // console.error('HttpDataService: Error posting data.', error.message);
         // More sophisticated error handling could be done here,
         // e.g., notifying a user feedback service, or retrying.
-        return throwError(() => new Error(`Error posting data: ${error.statusText} (Status: ${error.status})`));
+        // The server explains refused requests in the JSON body
+        const body = error.error as Partial<PostResponse> | null;
+        const details = body && Array.isArray(body.errors) && body.errors.length > 0 ? `: ${body.errors.join('; ')}` : '';
+        return throwError(() => new Error(`Error posting data: ${error.statusText} (Status: ${error.status})${details}`));
+      })
+    );
+  }
+
+  // Fetches the channel count from the server the backend URL points at
+  getChannelSummary(backendUrl: string): Observable<ChannelSummary> {
+    let url: URL;
+    try {
+      url = new URL('/channels', backendUrl.replace(/^ws(s?):\/\//, 'http$1://'));
+    } catch {
+      return throwError(() => new Error('Backend URL not configured.'));
+    }
+
+    return this.http.get<ChannelSummary>(url.toString()).pipe(
+      catchError((error: HttpErrorResponse) => {
+        return throwError(() => new Error(`Error fetching the channel count: ${error.statusText} (Status: ${error.status})`));
       })
     );
   }
@@ -35,7 +35,8 @@ describe('SettingsModalComponent', () => {
         // 'updateDarkMode', // Removed
         'resetToDefaults',
         'getCurrentNumChannels',
-        'getCurrentChannelDescriptions'
+        'getCurrentChannelDescriptions',
+        'getCurrentMaxChannels'
       ]
     );
 
@@ -50,6 +51,7 @@ describe('SettingsModalComponent', () => {
     mockChannelSettingsService.getCurrentAppSettings.and.returnValue(settingsForChannelService as AppSettings); // Cast to AppSettings
     mockChannelSettingsService.getCurrentNumChannels.and.returnValue(initialTestSettings.numChannels);
     mockChannelSettingsService.getCurrentChannelDescriptions.and.returnValue([...initialTestSettings.channelDescriptions]);
+    mockChannelSettingsService.getCurrentMaxChannels.and.returnValue(12);
 
     mockThemeService.getAvailableThemes.and.returnValue(mockThemes);
     mockThemeService.getActiveTheme.and.returnValue(mockThemes[0]); // Default to light theme
@@ -19,6 +19,7 @@ export class SettingsModalComponent implements OnInit {
   numChannels = 4;
   descriptions: string[] = [];
   backendUrl = '';
+  maxChannels = 12; // Replaced on init by the channel count reported by the server
   // darkMode = false; // Removed, will be handled by ThemeService
 
   // Theme related properties
@@ -38,6 +39,7 @@ export class SettingsModalComponent implements OnInit {
       currentSettings.channelDescriptions[i] || `Channel ${i + 1}`
     );
     this.backendUrl = currentSettings.backendUrl;
+    this.maxChannels = this.channelSettingsService.getCurrentMaxChannels();
     // this.darkMode = currentSettings.darkMode; // Removed
 
     // Initialize theme settings
@@ -53,8 +55,8 @@ export class SettingsModalComponent implements OnInit {
   onNumChannelsChange(newCountStr: string | number): void {
     const newCount = typeof newCountStr === 'string' ? parseInt(newCountStr, 10) : newCountStr;
 
-    if (isNaN(newCount) || newCount < 1 || newCount > 12) {
-        this.numChannelsError = 'Number of channels must be an integer between 1 and 12.';
+    if (isNaN(newCount) || newCount < 1 || newCount > this.maxChannels) {
+        this.numChannelsError = `Number of channels must be an integer between 1 and ${this.maxChannels}.`;
         return;
     }
     this.numChannelsError = null;
@@ -80,8 +82,8 @@ export class SettingsModalComponent implements OnInit {
     let hasError = false;
 
     const numCh = Number(this.numChannels);
-    if (isNaN(numCh) || numCh < 1 || numCh > 12) {
-      this.numChannelsError = 'Number of channels must be an integer between 1 and 12.';
+    if (isNaN(numCh) || numCh < 1 || numCh > this.maxChannels) {
+      this.numChannelsError = `Number of channels must be an integer between 1 and ${this.maxChannels}.`;
       hasError = true;
     }
 
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Color temperature units for ChannelMapping.CCTUnit
+const (
+	CCTUnitKelvin = "kelvin"
+	CCTUnitMired  = "mired" // Micro reciprocal degrees, 1,000,000 / Kelvin, as used by Zigbee
+)
+
+// Default color temperature limits in Kelvin, the range the color approximation covers
+const (
+	defaultCCTMin = 1000
+	defaultCCTMax = 40000
+)
+
+// cctSettings is a mapping's resolved color temperature output
+type cctSettings struct {
+	unit     string
+	min, max float64 // Kelvin
+}
+
+// cct resolves the mapping's color temperature settings, applying defaults
+func (cm ChannelMapping) cct() cctSettings {
+	c := cctSettings{unit: cm.CCTUnit, min: defaultCCTMin, max: defaultCCTMax}
+	if c.unit == "" {
+		c.unit = CCTUnitKelvin
+	}
+	if cm.CCTMin != nil {
+		c.min = *cm.CCTMin
+	}
+	if cm.CCTMax != nil {
+		c.max = *cm.CCTMax
+	}
+	return c
+}
+
+// validate checks the color temperature settings
+func (c cctSettings) validate() error {
+	if c.unit != CCTUnitKelvin && c.unit != CCTUnitMired {
+		return fmt.Errorf("has invalid cctUnit %q: must be kelvin or mired", c.unit)
+	}
+	if c.min <= 0 {
+		return fmt.Errorf("has invalid cctMin %v: must be a positive number of Kelvin", c.min)
+	}
+	if c.min >= c.max {
+		return fmt.Errorf("has cctMin %v not below cctMax %v", c.min, c.max)
+	}
+	return nil
+}
+
+// clamp limits a color temperature in Kelvin to the fixture's range
+func (c cctSettings) clamp(kelvin float64) float64 {
+	return math.Max(c.min, math.Min(c.max, kelvin))
+}
+
+// format renders a color temperature in Kelvin as an integer in the configured unit
+func (c cctSettings) format(kelvin float64) string {
+	if c.unit == CCTUnitMired {
+		return strconv.FormatInt(int64(math.Round(kelvinToMired(kelvin))), 10)
+	}
+	return strconv.FormatInt(int64(math.Round(kelvin)), 10)
+}
+
+// kelvinToMired converts between Kelvin and mired; the conversion is its own inverse
+func kelvinToMired(kelvin float64) float64 {
+	return 1e6 / kelvin
+}
+
+// kelvinFromColor approximates the correlated color temperature of an RGB color with
+// McCamy's formula. It is accurate for whites and near-whites; saturated colors give
+// values far outside the range of real fixtures, which the caller clamps.
+func kelvinFromColor(c RGB) float64 {
+	x, y := c.XY()
+	n := (x - 0.3320) / (0.1858 - y)
+	kelvin := 449*n*n*n + 3525*n*n + 6823.3*n + 5520.33
+	if math.IsNaN(kelvin) {
+		return defaultCCTMax
+	}
+	return kelvin
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestKelvinFromColor(t *testing.T) {
+	tests := []struct {
+		color    string
+		expected float64
+	}{
+		{color: "#FFFFFF", expected: 6504}, // sRGB white is D65
+		{color: "#FFB46B", expected: 3000}, // Warm white
+		{color: "#FF8A12", expected: 2000}, // Candle light
+		{color: "#FFE4CE", expected: 5000}, // Horizon daylight
+	}
+
+	for _, tt := range tests {
+		c, err := parseHexColor(tt.color)
+		if err != nil {
+			t.Fatalf("parseHexColor(%q) error: %v", tt.color, err)
+		}
+		// The approximation is good to within a few percent for whites
+		if got := kelvinFromColor(c); math.Abs(got-tt.expected) > tt.expected*0.05 {
+			t.Errorf("kelvinFromColor(%s) = %.0f, want about %.0f", tt.color, got, tt.expected)
+		}
+	}
+}
+
+func TestCCTSettings(t *testing.T) {
+	kelvin := ChannelMapping{CCTMin: floatPtr(2700), CCTMax: floatPtr(6500)}.cct()
+	mired := ChannelMapping{CCTUnit: CCTUnitMired, CCTMin: floatPtr(2000), CCTMax: floatPtr(6500)}.cct()
+
+	tests := []struct {
+		name     string
+		settings cctSettings
+		kelvin   float64
+		expected string
+	}{
+		{name: "Kelvin", settings: kelvin, kelvin: 4000.4, expected: "4000"},
+		{name: "Kelvin clamped to warmest", settings: kelvin, kelvin: 1800, expected: "2700"},
+		{name: "Kelvin clamped to coolest", settings: kelvin, kelvin: 10000, expected: "6500"},
+		{name: "Mired", settings: mired, kelvin: 2700, expected: "370"},
+		{name: "Mired clamped to coolest", settings: mired, kelvin: 10000, expected: "154"},
+		{name: "Mired clamped to warmest", settings: mired, kelvin: 1000, expected: "500"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.settings.format(tt.settings.clamp(tt.kelvin)); got != tt.expected {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.expected)
+		}
+	}
+
+	for name, mapping := range map[string]ChannelMapping{
+		"Unknown unit":         {CCTUnit: "celsius"},
+		"Negative minimum":     {CCTMin: floatPtr(-1)},
+		"Minimum above max":    {CCTMin: floatPtr(6500), CCTMax: floatPtr(2700)},
+		"Minimum equal to max": {CCTMin: floatPtr(2700), CCTMax: floatPtr(2700)},
+	} {
+		if err := mapping.cct().validate(); err == nil {
+			t.Errorf("%s: validate() expected an error, but got nil", name)
+		}
+	}
+}
+
+func TestCCTPublish(t *testing.T) {
+	cfg := &Config{
+		ChannelMappings: []ChannelMapping{
+			{ChannelNumber: 1, IntensityTopic: "ch1/intensity", ColorTopic: "ch1/color", OnOffTopic: "ch1/onoff",
+				CCTTopic: "ch1/cct", CCTMin: floatPtr(2700), CCTMax: floatPtr(6500), CCTFromColor: boolPtr(true)},
+			{ChannelNumber: 2, IntensityTopic: "ch2/intensity", ColorTopic: "ch2/color", OnOffTopic: "ch2/onoff",
+				CCTTopic: "ch2/cct", CCTUnit: CCTUnitMired, CCTPayload: `{"color_temp":{{.CCT}}}`},
+			{ChannelNumber: 3, IntensityTopic: "ch3/intensity", ColorTopic: "ch3/color", OnOffTopic: "ch3/onoff", CCTTopic: "ch3/cct"},
+		},
+	}
+	mockMQTT := &MockMQTTClient{}
+	httpServer := NewHTTPServer(cfg, mockMQTT)
+
+	results := httpServer.processDataPoints([]IncomingDataPoint{
+		{ChannelNumber: 1, Value: json.Number("50"), Color: "#FFFFFF", Kelvin: json.Number("2000")}, // Below the fixture's range
+		{ChannelNumber: 2, Value: json.Number("50"), Color: "#FFFFFF", Kelvin: json.Number("4000")},
+		{ChannelNumber: 1, Value: json.Number("50"), Color: "#FFFFFF", Kelvin: json.Number("-5")},
+	}, "test")
+
+	if !containsMessage(mockMQTT.PublishedMessages["ch1/cct"], "2700") {
+		t.Errorf("Expected clamped Kelvin on ch1/cct, got %v", mockMQTT.PublishedMessages["ch1/cct"])
+	}
+	if !containsMessage(mockMQTT.PublishedMessages["ch2/cct"], `{"color_temp":250}`) {
+		t.Errorf("Expected mired payload on ch2/cct, got %v", mockMQTT.PublishedMessages["ch2/cct"])
+	}
+	if results[2].Status != DeliveryRejected {
+		t.Errorf("Expected a negative kelvin to be rejected, got %+v", results[2])
+	}
+	if state, _ := httpServer.state.Get(2); state.Kelvin != 4000 {
+		t.Errorf("Expected kelvin to be recorded in the state, got %+v", state)
+	}
+
+	// Without kelvin, white-only fixtures get the color temperature closest to the color
+	httpServer.processDataPoints([]IncomingDataPoint{{ChannelNumber: 1, Value: json.Number("50"), Color: "#FFB46B"}}, "test")
+	if !containsMessage(mockMQTT.PublishedMessages["ch1/cct"], "2923") {
+		t.Errorf("Expected color temperature approximated from the color on ch1/cct, got %v", mockMQTT.PublishedMessages["ch1/cct"])
+	}
+
+	// RGB+CCT fixtures keep the chosen color: no color temperature unless one is sent
+	httpServer.processDataPoints([]IncomingDataPoint{{ChannelNumber: 3, Value: json.Number("50"), Color: "#FF0000"}}, "test")
+	if !containsMessage(mockMQTT.PublishedMessages["ch3/color"], "#FF0000") {
+		t.Errorf("Expected the color on ch3/color, got %v", mockMQTT.PublishedMessages["ch3/color"])
+	}
+	if messages := mockMQTT.PublishedMessages["ch3/cct"]; len(messages) != 0 {
+		t.Errorf("Expected no color temperature derived from the color on ch3/cct, got %v", messages)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxChannelRange limits how many mappings a single channelRange entry may generate, to
+// catch typos like "1-4800" before they create an unreasonably large channel map and
+// leave as many retained topics on the broker
+const maxChannelRange = 4096
+
+// generateChannelMappings replaces every channelRange entry with one mapping per channel
+// in the range, filling in {n} in the id, and in the topics of entries without a profile
+// (expandChannelMapping fills in those of a profile). It also returns, for each resulting mapping, the index of the entry it
+// came from, so errors can point at the line in the config file. Invalid entries are
+// left out, and their errors joined, so the remaining entries can still be checked.
+func generateChannelMappings(mappings []ChannelMapping) ([]ChannelMapping, []int, error) {
+	var generated []ChannelMapping
+	var sources []int
+	var errs []error
+
+	for i, cm := range mappings {
+		if cm.ChannelRange == "" {
+			generated = append(generated, cm)
+			sources = append(sources, i)
+			continue
+		}
+
+		first, last, err := parseChannelRange(cm.ChannelRange)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("channelMapping at index %d %w", i, err))
+			continue
+		}
+		if cm.ChannelNumber != 0 {
+			errs = append(errs, fmt.Errorf("channelMapping at index %d has both channelNumber and channelRange set", i))
+			continue
+		}
+
+		for n := first; n <= last; n++ {
+			channel := cm
+			channel.ChannelNumber = n
+			channel.ChannelRange = ""
+			// The id usually tells the generated fixtures apart, e.g. "wash-{n}"
+			values := map[string]string{"n": strconv.Itoa(n)}
+			err := expandPlaceholders("id", &channel.ID, values)
+			if err == nil && channel.Profile == "" {
+				err = expandTopicPlaceholders(&channel, values)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("channelMapping at index %d (channelRange %s) %w", i, cm.ChannelRange, err))
+				break // The same problem for every channel in the range
+			}
+			generated = append(generated, channel)
+			sources = append(sources, i)
+		}
+	}
+	return generated, sources, errors.Join(errs...)
+}
+
+// parseChannelRange parses an inclusive range of channel numbers like "1-48"
+func parseChannelRange(s string) (int, int, error) {
+	firstText, lastText, ok := strings.Cut(s, "-")
+	first, firstErr := strconv.Atoi(strings.TrimSpace(firstText))
+	last, lastErr := strconv.Atoi(strings.TrimSpace(lastText))
+	if !ok || firstErr != nil || lastErr != nil {
+		return 0, 0, fmt.Errorf("has invalid channelRange %q: expected first-last, e.g. 1-48", s)
+	}
+	if first > last {
+		return 0, 0, fmt.Errorf("has invalid channelRange %q: first channel is after the last", s)
+	}
+	if last-first+1 > maxChannelRange {
+		return 0, 0, fmt.Errorf("has channelRange %q covering more than %d channels", s, maxChannelRange)
+	}
+	return first, last, nil
+}
+
+// applyPlaceholderOffset evaluates the arithmetic in a placeholder like {n*3+1} against
+// the placeholder's integer value. scale and offset are the matched "*3" and "+1"
+// parts, either of which may be empty.
+func applyPlaceholderOffset(value, scale, offset string) (string, error) {
+	if scale == "" && offset == "" {
+		return value, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return "", fmt.Errorf("arithmetic needs a number, but the value is %q", value)
+	}
+	if scale != "" {
+		factor, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(scale), "*")))
+		if err != nil {
+			return "", fmt.Errorf("invalid multiplier %q", scale)
+		}
+		n *= factor
+	}
+	if offset != "" {
+		delta, err := strconv.Atoi(strings.ReplaceAll(offset, " ", ""))
+		if err != nil {
+			return "", fmt.Errorf("invalid offset %q", offset)
+		}
+		n += delta
+	}
+	return strconv.Itoa(n), nil
+}
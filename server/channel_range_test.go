@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigWithChannelRanges(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "par.yaml"), []byte(`
+name: par
+intensityTopic: "dmx/1/{n*4-3}"
+colorTopic: "fixtures/{id}/color"
+onOffTopic: "fixtures/{id}/power"
+`), 0644); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+	configPath := filepath.Join(tempDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(`
+mqttBroker: "tcp://localhost:1883"
+fixtureProfiles: [par.yaml]
+channelMappings:
+  - channelRange: 1-3
+    intensityTopic: "lightboard/channel/{n}/intensity"
+    colorTopic: "lightboard/channel/{n}/color"
+    onOffTopic: "lightboard/channel/{n+100}/onoff"
+  - channelNumber: 10
+    intensityTopic: "home/{kitchen}/i"
+    colorTopic: "explicit/color"
+    onOffTopic: "explicit/onoff"
+  - channelRange: 20-21
+    profile: par
+    id: "par-{n-19}"
+`), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+
+	expected := []ChannelMapping{
+		{ChannelNumber: 1, IntensityTopic: "lightboard/channel/1/intensity", ColorTopic: "lightboard/channel/1/color", OnOffTopic: "lightboard/channel/101/onoff"},
+		{ChannelNumber: 2, IntensityTopic: "lightboard/channel/2/intensity", ColorTopic: "lightboard/channel/2/color", OnOffTopic: "lightboard/channel/102/onoff"},
+		{ChannelNumber: 3, IntensityTopic: "lightboard/channel/3/intensity", ColorTopic: "lightboard/channel/3/color", OnOffTopic: "lightboard/channel/103/onoff"},
+		{ChannelNumber: 10, IntensityTopic: "home/{kitchen}/i", ColorTopic: "explicit/color", OnOffTopic: "explicit/onoff"},
+		{ChannelNumber: 20, Profile: "par", ID: "par-1", IntensityTopic: "dmx/1/77", ColorTopic: "fixtures/par-1/color", OnOffTopic: "fixtures/par-1/power"},
+		{ChannelNumber: 21, Profile: "par", ID: "par-2", IntensityTopic: "dmx/1/81", ColorTopic: "fixtures/par-2/color", OnOffTopic: "fixtures/par-2/power"},
+	}
+	if !reflect.DeepEqual(cfg.ChannelMappings, expected) {
+		t.Errorf("LoadConfig() generated mappings\n got = %+v\nwant = %+v", cfg.ChannelMappings, expected)
+	}
+}
+
+func TestChannelRangeErrors(t *testing.T) {
+	topics := `intensityTopic: "c/{n}/i", colorTopic: "c/{n}/c", onOffTopic: "c/{n}/o"`
+	tests := []struct {
+		name     string
+		mappings string
+		errorMsg string
+	}{
+		{
+			name:     "Duplicate explicit channels",
+			mappings: `[{channelNumber: 1, ` + topics + `}, {channelNumber: 1, ` + topics + `}]`,
+			errorMsg: "channelNumber 1 is mapped more than once (at index 0 and 1)",
+		},
+		{
+			name:     "Explicit channel inside a range",
+			mappings: `[{channelRange: 1-48, ` + topics + `}, {channelNumber: 12, ` + topics + `}]`,
+			errorMsg: "channelNumber 12 is mapped more than once (at index 0 and 1)",
+		},
+		{
+			name:     "Overlapping ranges",
+			mappings: `[{channelRange: 1-10, ` + topics + `}, {channelRange: 10-20, ` + topics + `}]`,
+			errorMsg: "channelNumber 10 is mapped more than once",
+		},
+		{
+			name:     "Malformed range",
+			mappings: `[{channelRange: "1..48", ` + topics + `}]`,
+			errorMsg: `invalid channelRange "1..48"`,
+		},
+		{
+			name:     "Reversed range",
+			mappings: `[{channelRange: 48-1, ` + topics + `}]`,
+			errorMsg: "first channel is after the last",
+		},
+		{
+			name:     "Huge range",
+			mappings: `[{channelRange: 1-100000, ` + topics + `}]`,
+			errorMsg: "covering more than",
+		},
+		{
+			name:     "Range and channel number",
+			mappings: `[{channelRange: 1-4, channelNumber: 2, ` + topics + `}]`,
+			errorMsg: "both channelNumber and channelRange",
+		},
+		{
+			name:     "Unknown placeholder in a generated topic",
+			mappings: `[{channelRange: 1-4, intensityTopic: "c/{x}/i", colorTopic: "c", onOffTopic: "o"}]`,
+			errorMsg: "unresolved placeholder {x}",
+		},
+		{
+			name:     "Arithmetic on a text placeholder",
+			mappings: `[{channelNumber: 1, profile: p, id: a}]`,
+			errorMsg: "invalid placeholder {id+1}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(tempDir, "p.yaml"), []byte("name: p\nintensityTopic: \"x/{id+1}\"\ncolorTopic: c\nonOffTopic: o"), 0644); err != nil {
+				t.Fatalf("Failed to write profile: %v", err)
+			}
+			configPath := filepath.Join(tempDir, "config.yaml")
+			config := "mqttBroker: \"tcp://localhost:1883\"\nfixtureProfiles: [p.yaml]\nchannelMappings: " + tt.mappings
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+
+			_, err := LoadConfig(configPath)
+			if err == nil {
+				t.Fatalf("LoadConfig() expected an error containing %q, but got nil", tt.errorMsg)
+			}
+			if !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Errorf("LoadConfig() error = %q, want it to contain %q", err, tt.errorMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ChannelSummary is the response of GET /channels, which needs no API token
+type ChannelSummary struct {
+	ChannelCount     int `json:"channelCount"`     // Number of mapped channels
+	MaxChannelNumber int `json:"maxChannelNumber"` // Highest mapped channel number, i.e. how many faders a UI needs
+}
+
+// ChannelList is the response of GET /api/channels
+type ChannelList struct {
+	ChannelSummary
+	Channels []ChannelMapping `json:"channels"` // Resolved mappings, by channel number
+}
+
+// errGeneratedChannel is returned when writing back a change to a channel that is
+// generated by a channelRange entry, which can only be edited as a whole
+var errGeneratedChannel = errors.New("is generated by a channelRange entry; edit the range in the configuration file instead")
+
+// requireAPIToken only lets requests through that carry the configured apiToken as a
+// bearer token. Without an apiToken, the API is disabled.
+func (hs *HTTPServer) requireAPIToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg, _ := hs.current()
+		if cfg.APIToken == "" {
+			http.Error(w, "The channel management API is disabled; set apiToken in the configuration to enable it", http.StatusForbidden)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.APIToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="lightboard"`)
+			http.Error(w, "Missing or invalid API token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleChannelSummaryRequest serves GET /channels with the channel count, so a UI can
+// size itself without holding the API token
+func (hs *HTTPServer) handleChannelSummaryRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is accepted", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, hs.channelList().ChannelSummary)
+}
+
+// handleChannelsRequest serves GET /api/channels with every channel mapping
+func (hs *HTTPServer) handleChannelsRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is accepted", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, hs.channelList())
+}
+
+// channelList lists the channel mappings by channel number
+func (hs *HTTPServer) channelList() ChannelList {
+	hs.channelMapLock.RLock()
+	list := ChannelList{ChannelSummary: ChannelSummary{ChannelCount: len(hs.channelMap)}, Channels: make([]ChannelMapping, 0, len(hs.channelMap))}
+	for _, mapping := range hs.channelMap {
+		list.Channels = append(list.Channels, mapping)
+		list.MaxChannelNumber = max(list.MaxChannelNumber, mapping.ChannelNumber)
+	}
+	hs.channelMapLock.RUnlock()
+
+	sort.Slice(list.Channels, func(i, j int) bool { return list.Channels[i].ChannelNumber < list.Channels[j].ChannelNumber })
+	return list
+}
+
+// handleChannelRequest serves GET, PUT and DELETE /api/channels/{channelNumber}. A PUT
+// body is a channelMappings entry in JSON, validated exactly as in the config file.
+func (hs *HTTPServer) handleChannelRequest(w http.ResponseWriter, r *http.Request) {
+	channelNumber, err := strconv.Atoi(r.PathValue("channelNumber"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid channelNumber: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		hs.channelMapLock.RLock()
+		mapping, ok := hs.channelMap[channelNumber]
+		hs.channelMapLock.RUnlock()
+		if !ok {
+			http.Error(w, fmt.Sprintf("No topic mapping found for channelNumber: %d", channelNumber), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, mapping)
+
+	case http.MethodPut:
+		mapping, err := decodeChannelMapping(r.Body, channelNumber)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resolved, created, err := hs.putChannel(mapping)
+		if err != nil {
+			writeChannelUpdateError(w, err)
+			return
+		}
+		if created {
+			log.Printf("Channel mapping for channelNumber %d added through the API", channelNumber)
+			writeJSON(w, http.StatusCreated, resolved)
+		} else {
+			log.Printf("Channel mapping for channelNumber %d updated through the API", channelNumber)
+			writeJSON(w, http.StatusOK, resolved)
+		}
+
+	case http.MethodDelete:
+		if err := hs.deleteChannel(channelNumber); err != nil {
+			writeChannelUpdateError(w, err)
+			return
+		}
+		log.Printf("Channel mapping for channelNumber %d removed through the API", channelNumber)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Only GET, PUT and DELETE methods are accepted", http.StatusMethodNotAllowed)
+	}
+}
+
+// channelUpdateError carries the HTTP status for a rejected channel change
+type channelUpdateError struct {
+	status int
+	err    error
+}
+
+func (e *channelUpdateError) Error() string { return e.err.Error() }
+func (e *channelUpdateError) Unwrap() error { return e.err }
+
+// writeChannelUpdateError answers a failed PUT or DELETE with the error's status
+func writeChannelUpdateError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var updateErr *channelUpdateError
+	if errors.As(err, &updateErr) {
+		status = updateErr.status
+	}
+	if status == http.StatusInternalServerError {
+		log.Printf("Channel update failed: %v", err)
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// decodeChannelMapping reads a PUT body for channelNumber. Like the config file, unknown
+// fields are rejected. channelNumber may be left out of the body, but must match if given.
+func decodeChannelMapping(body io.Reader, channelNumber int) (ChannelMapping, error) {
+	var mapping ChannelMapping
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&mapping); err != nil {
+		return mapping, fmt.Errorf("Invalid JSON payload: %v", err)
+	}
+	if mapping.ChannelNumber != 0 && mapping.ChannelNumber != channelNumber {
+		return mapping, fmt.Errorf("channelNumber %d in the body does not match channelNumber %d in the URL", mapping.ChannelNumber, channelNumber)
+	}
+	if mapping.ChannelRange != "" {
+		return mapping, fmt.Errorf("channelRange can't be set through the API; add each channel separately")
+	}
+	mapping.ChannelNumber = channelNumber
+	return mapping, nil
+}
+
+// putChannel validates a mapping as LoadConfig does and adds or replaces the channel,
+// writing the change back to the config file first if apiWriteConfig is set. It
+// returns the resolved mapping and whether the channel is new. API changes are
+// serialized by apiLock, so the file is written without holding up /post and /ws.
+func (hs *HTTPServer) putChannel(mapping ChannelMapping) (ChannelMapping, bool, error) {
+	hs.apiLock.Lock()
+	defer hs.apiLock.Unlock()
+
+	cfg, _ := hs.current()
+	resolved, err := resolveChannelMapping(mapping, cfg.profiles)
+	if err != nil {
+		return mapping, false, &channelUpdateError{http.StatusBadRequest, fmt.Errorf("channelMapping for channelNumber %d %w", mapping.ChannelNumber, err)}
+	}
+	if cfg.APIWriteConfig {
+		if err := writeConfigChannel(hs.configPath, mapping.ChannelNumber, &mapping); err != nil {
+			return mapping, false, err
+		}
+	}
+
+	hs.channelMapLock.Lock()
+	defer hs.channelMapLock.Unlock()
+	_, exists := hs.channelMap[mapping.ChannelNumber]
+	hs.setChannel(mapping.ChannelNumber, &resolved, cfg.APIWriteConfig)
+	return resolved, !exists, nil
+}
+
+// deleteChannel removes a channel, from the config file too if apiWriteConfig is set
+func (hs *HTTPServer) deleteChannel(channelNumber int) error {
+	hs.apiLock.Lock()
+	defer hs.apiLock.Unlock()
+
+	hs.channelMapLock.RLock()
+	cfg := hs.config
+	_, ok := hs.channelMap[channelNumber]
+	count := len(hs.channelMap)
+	hs.channelMapLock.RUnlock()
+	if !ok {
+		return &channelUpdateError{http.StatusNotFound, fmt.Errorf("No topic mapping found for channelNumber: %d", channelNumber)}
+	}
+	if count == 1 {
+		return &channelUpdateError{http.StatusConflict, fmt.Errorf("channelNumber %d is the last channel; at least one channelMapping must be configured", channelNumber)}
+	}
+	if cfg.APIWriteConfig {
+		if err := writeConfigChannel(hs.configPath, channelNumber, nil); err != nil {
+			return err
+		}
+	}
+
+	hs.channelMapLock.Lock()
+	defer hs.channelMapLock.Unlock()
+	hs.setChannel(channelNumber, nil, cfg.APIWriteConfig)
+	return nil
+}
+
+// setChannel swaps in a copy of the configuration whose channelMappings entry for
+// channelNumber is replaced by mapping, added if there is none, or removed if mapping is
+// nil, together with its channel map. Callers hold channelMapLock. The running
+// configuration and channel map are copied rather than changed, since requests may be
+// using them. Unless the change was written to the config file, the channel is noted,
+// so a reload dropping it can say so.
+func (hs *HTTPServer) setChannel(channelNumber int, mapping *ChannelMapping, written bool) {
+	next := *hs.config
+	next.ChannelMappings = make([]ChannelMapping, 0, len(hs.config.ChannelMappings)+1)
+	found := false
+	for _, cm := range hs.config.ChannelMappings {
+		if cm.ChannelNumber != channelNumber {
+			next.ChannelMappings = append(next.ChannelMappings, cm)
+		} else if mapping != nil {
+			next.ChannelMappings = append(next.ChannelMappings, *mapping)
+			found = true
+		}
+	}
+	if mapping != nil && !found {
+		next.ChannelMappings = append(next.ChannelMappings, *mapping)
+	}
+	hs.config = &next
+	hs.channelMap = newChannelMap(&next)
+
+	if !written {
+		if hs.apiChannels == nil {
+			hs.apiChannels = make(map[int]bool)
+		}
+		hs.apiChannels[channelNumber] = true
+	}
+}
+
+// writeConfigChannel replaces the channelMappings entry for channelNumber in the config
+// file with mapping, adding it if there is none, or removes the entry if mapping is nil.
+// Only the lines of that entry change; the rest of the file, including comments, blank
+// lines and formatting, stays as it is. A channelMappings list written in flow style, or
+// missing, is written out again as a whole in block style.
+func writeConfigChannel(path string, channelNumber int, mapping *ChannelMapping) error {
+	if path == "" {
+		return fmt.Errorf("apiWriteConfig is set but the configuration file is unknown")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file '%s': %w", path, err)
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("failed to parse config file '%s': %w", path, err)
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode || document.Content[0].Style&yaml.FlowStyle != 0 {
+		return fmt.Errorf("config file '%s' is not a YAML mapping in block style", path)
+	}
+
+	var entry *yaml.Node
+	if mapping != nil {
+		if entry, err = encodeConfigEntry(channelNumber, mapping); err != nil {
+			return err
+		}
+	}
+
+	root := document.Content[0]
+	lines := strings.SplitAfter(string(data), "\n")
+	var key, entries *yaml.Node
+	nextLine := len(lines) + 1 // Line of the setting after channelMappings
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "channelMappings" {
+			key, entries = root.Content[i], root.Content[i+1]
+			if i+2 < len(root.Content) {
+				nextLine = root.Content[i+2].Line
+			}
+		}
+	}
+
+	index := -1
+	if entries != nil {
+		for i, existing := range entries.Content {
+			number, channelRange := configEntryChannel(existing)
+			if channelRange == "" && number == channelNumber {
+				index = i
+				break
+			}
+			if first, last, err := parseChannelRange(channelRange); err == nil && channelNumber >= first && channelNumber <= last {
+				return &channelUpdateError{http.StatusConflict, fmt.Errorf("channelNumber %d %w (channelRange %s)", channelNumber, errGeneratedChannel, channelRange)}
+			}
+		}
+	}
+	if mapping == nil && index < 0 {
+		return nil // Not in the file, e.g. added through the API before apiWriteConfig was set
+	}
+
+	if entries != nil && entries.Kind == yaml.SequenceNode && entries.Style&yaml.FlowStyle == 0 && len(entries.Content) > 0 {
+		if edited, ok := editBlockEntry(lines, entries, index, nextLine, entry); ok {
+			return writeFileAtomic(path, []byte(edited))
+		}
+	}
+
+	// Write out the whole list; entries written in flow style stay that way
+	if key == nil {
+		key = &yaml.Node{Kind: yaml.ScalarNode, Value: "channelMappings"}
+	}
+	if entries == nil || entries.Kind != yaml.SequenceNode { // Missing, or left empty
+		entries = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+	entries.Style &^= yaml.FlowStyle
+	switch {
+	case mapping == nil:
+		entries.Content = append(entries.Content[:index], entries.Content[index+1:]...)
+	case index < 0:
+		entries.Content = append(entries.Content, entry)
+	default:
+		entries.Content[index] = entry
+	}
+	text, err := encodeYAML(&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: key.Value}, entries}})
+	if err != nil {
+		return fmt.Errorf("failed to encode channelMappings for config file '%s': %w", path, err)
+	}
+	if key.Line == 0 { // New setting at the end of the file
+		content := string(data)
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		return writeFileAtomic(path, []byte(content+text))
+	}
+	return writeFileAtomic(path, []byte(replaceLines(lines, key.Line, settingEnd(lines, key.Line, nextLine), text)))
+}
+
+// editBlockEntry replaces the lines of entries.Content[index] with entry, adds entry
+// after the last entry if index is negative, or removes the entry and the comment above
+// it if entry is nil. nextLine is the line of whatever follows the list. It reports false
+// if the entries aren't laid out one per "- " item, so the lines can't be edited.
+func editBlockEntry(lines []string, entries *yaml.Node, index, nextLine int, entry *yaml.Node) (string, bool) {
+	anchor := index
+	if anchor < 0 {
+		anchor = len(entries.Content) - 1
+	}
+	existing := entries.Content[anchor]
+	line := lines[existing.Line-1]
+	if existing.Column-1 > len(line) {
+		return "", false
+	}
+	prefix := line[:existing.Column-1] // e.g. "  - "
+	if strings.Trim(prefix, " -") != "" || !strings.Contains(prefix, "-") {
+		return "", false
+	}
+	end := nextLine
+	if anchor+1 < len(entries.Content) {
+		end = entries.Content[anchor+1].Line
+	}
+	end = settingEnd(lines, existing.Line, end)
+
+	if entry == nil {
+		start := existing.Line
+		for start > 1 && strings.HasPrefix(strings.TrimSpace(lines[start-2]), "#") {
+			start-- // The entry's own comment goes with it
+		}
+		if start > 1 && strings.TrimSpace(lines[start-2]) == "" && end < len(lines) && strings.TrimSpace(lines[end]) == "" {
+			end++ // Don't leave two blank lines where the entry was
+		}
+		return replaceLines(lines, start, end, ""), true
+	}
+
+	text, err := encodeYAML(entry)
+	if err != nil {
+		return "", false
+	}
+	indent := strings.Repeat(" ", len(prefix))
+	var b strings.Builder
+	for i, entryLine := range strings.SplitAfter(strings.TrimSuffix(text, "\n"), "\n") {
+		if i == 0 {
+			b.WriteString(prefix)
+		} else {
+			b.WriteString(indent)
+		}
+		b.WriteString(entryLine)
+	}
+	b.WriteString("\n")
+
+	if index < 0 {
+		return replaceLines(lines, end+1, end, b.String()), true
+	}
+	return replaceLines(lines, existing.Line, end, b.String()), true
+}
+
+// settingEnd finds the last line of a setting or entry starting at line start, given
+// the line of whatever follows it. Blank and comment lines before that belong to the
+// next one, or to nothing, and are left out.
+func settingEnd(lines []string, start, next int) int {
+	end := min(next-1, len(lines))
+	for end > start {
+		if trimmed := strings.TrimSpace(lines[end-1]); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		end--
+	}
+	return end
+}
+
+// replaceLines replaces lines first to last, counting from 1, with text. With last
+// before first, text is inserted before line first.
+func replaceLines(lines []string, first, last int, text string) string {
+	var b strings.Builder
+	for _, line := range lines[:first-1] {
+		b.WriteString(line)
+	}
+	if text != "" && first > 1 && !strings.HasSuffix(lines[first-2], "\n") {
+		b.WriteString("\n") // Inserted after a last line without a newline
+	}
+	b.WriteString(text)
+	for _, line := range lines[max(last, first-1):] {
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// encodeConfigEntry encodes a channelMappings entry as it is written to the config file:
+// only the settings that are set, but always with its channelNumber
+func encodeConfigEntry(channelNumber int, mapping *ChannelMapping) (*yaml.Node, error) {
+	written := *mapping
+	written.ChannelNumber = channelNumber
+	var entry yaml.Node
+	if err := entry.Encode(&written); err != nil {
+		return nil, fmt.Errorf("failed to encode channelMapping for channelNumber %d: %w", channelNumber, err)
+	}
+	omitEmptyValues(&entry)
+	if len(entry.Content) == 0 || entry.Content[0].Value != "channelNumber" {
+		// channelNumber is left out when 0, as it is for channelRange entries
+		entry.Content = append([]*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "channelNumber"},
+			{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(channelNumber)},
+		}, entry.Content...)
+	}
+	return &entry, nil
+}
+
+// encodeYAML encodes a node the way the bundled files are written, indented by 2 spaces
+func encodeYAML(node *yaml.Node) (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// omitEmptyValues drops the settings left empty from an encoded mapping, such as the
+// topics of an entry using a profile, so the file only lists what was set
+func omitEmptyValues(mapping *yaml.Node) {
+	content := mapping.Content[:0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if value := mapping.Content[i+1]; value.Kind == yaml.ScalarNode && value.Value == "" {
+			continue
+		}
+		content = append(content, mapping.Content[i], mapping.Content[i+1])
+	}
+	mapping.Content = content
+}
+
+// configEntryChannel reads the channelNumber and channelRange of a channelMappings entry
+// in a YAML document. A missing or non-numeric channelNumber is returned as 0.
+func configEntryChannel(entry *yaml.Node) (int, string) {
+	number, channelRange := 0, ""
+	for i := 0; i+1 < len(entry.Content); i += 2 {
+		switch entry.Content[i].Value {
+		case "channelNumber":
+			number, _ = strconv.Atoi(entry.Content[i+1].Value)
+		case "channelRange":
+			channelRange = entry.Content[i+1].Value
+		}
+	}
+	return number, channelRange
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChannelsAPI(t *testing.T) {
+	cfg := &Config{
+		APIToken: "s3cret",
+		ChannelMappings: []ChannelMapping{
+			{ChannelNumber: 1, IntensityTopic: "ch1/intensity", ColorTopic: "ch1/color", OnOffTopic: "ch1/onoff"},
+			{ChannelNumber: 3, IntensityTopic: "ch3/intensity", ColorTopic: "ch3/color", OnOffTopic: "ch3/onoff"},
+		},
+		profiles: map[string]FixtureProfile{
+			"par": {Name: "par", ChannelMapping: ChannelMapping{IntensityTopic: "{id}/dimmer", ColorTopic: "{id}/color", OnOffTopic: "{id}/power"}},
+		},
+	}
+	httpServer := NewHTTPServer(cfg, &MockMQTTClient{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/channels", corsMiddlewareWithMethods("GET, OPTIONS", httpServer.handleChannelSummaryRequest))
+	mux.HandleFunc("/api/channels", corsMiddlewareWithMethods("GET, OPTIONS", httpServer.requireAPIToken(httpServer.handleChannelsRequest)))
+	mux.HandleFunc("/api/channels/{channelNumber}", corsMiddlewareWithMethods("GET, PUT, DELETE, OPTIONS", httpServer.requireAPIToken(httpServer.handleChannelRequest)))
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	tests := []struct {
+		name               string
+		method             string
+		path               string
+		token              string
+		body               string
+		expectedStatusCode int
+		expectedBody       string // Expected response body substring
+	}{
+		{"Missing token", http.MethodGet, "/api/channels", "", "", http.StatusUnauthorized, "Missing or invalid API token"},
+		{"Wrong token", http.MethodGet, "/api/channels", "guess", "", http.StatusUnauthorized, "Missing or invalid API token"},
+		{"Preflight without token", http.MethodOptions, "/api/channels/1", "", "", http.StatusNoContent, ""},
+		{"Channel count without token", http.MethodGet, "/channels", "", "", http.StatusOK, `{"channelCount":2,"maxChannelNumber":3}`},
+		{"Channel count is read-only", http.MethodPut, "/channels", "", "", http.StatusMethodNotAllowed, "Only GET method is accepted"},
+		{"List channels", http.MethodGet, "/api/channels", "s3cret", "", http.StatusOK, `"channelCount":2,"maxChannelNumber":3`},
+		{"Get channel", http.MethodGet, "/api/channels/3", "s3cret", "", http.StatusOK, `"intensityTopic":"ch3/intensity"`},
+		{"Get unmapped channel", http.MethodGet, "/api/channels/2", "s3cret", "", http.StatusNotFound, "No topic mapping found"},
+		{"Invalid channel number", http.MethodGet, "/api/channels/two", "s3cret", "", http.StatusBadRequest, "Invalid channelNumber"},
+		{"Add channel", http.MethodPut, "/api/channels/12", "s3cret", `{"intensityTopic":"ch12/intensity","colorTopic":"ch12/color","onOffTopic":"ch12/onoff"}`, http.StatusCreated, `"channelNumber":12`},
+		{"Update channel", http.MethodPut, "/api/channels/1", "s3cret", `{"channelNumber":1,"intensityTopic":"patched/intensity","colorTopic":"patched/color","onOffTopic":"patched/onoff"}`, http.StatusOK, `"intensityTopic":"patched/intensity"`},
+		{"Add channel from a profile", http.MethodPut, "/api/channels/4", "s3cret", `{"profile":"par","id":"par4"}`, http.StatusCreated, `"intensityTopic":"par4/dimmer"`},
+		{"Unknown profile", http.MethodPut, "/api/channels/5", "s3cret", `{"profile":"spot","id":"spot5"}`, http.StatusBadRequest, `channelMapping for channelNumber 5 references unknown fixture profile "spot"`},
+		{"Invalid mapping", http.MethodPut, "/api/channels/5", "s3cret", `{"intensityTopic":"ch5/+","colorTopic":"ch5/color","onOffTopic":"ch5/onoff"}`, http.StatusBadRequest, "wildcards"},
+		{"Unknown field", http.MethodPut, "/api/channels/5", "s3cret", `{"intensityTopik":"ch5/intensity"}`, http.StatusBadRequest, "unknown field"},
+		{"Mismatched channel number", http.MethodPut, "/api/channels/5", "s3cret", `{"channelNumber":6,"intensityTopic":"ch6/intensity","colorTopic":"ch6/color","onOffTopic":"ch6/onoff"}`, http.StatusBadRequest, "does not match"},
+		{"Channel range", http.MethodPut, "/api/channels/5", "s3cret", `{"channelRange":"5-8","intensityTopic":"ch{n}/intensity","colorTopic":"ch{n}/color","onOffTopic":"ch{n}/onoff"}`, http.StatusBadRequest, "channelRange can't be set"},
+		{"Delete channel", http.MethodDelete, "/api/channels/3", "s3cret", "", http.StatusNoContent, ""},
+		{"Delete unmapped channel", http.MethodDelete, "/api/channels/3", "s3cret", "", http.StatusNotFound, "No topic mapping found"},
+		{"List after changes", http.MethodGet, "/api/channels", "s3cret", "", http.StatusOK, `"channelCount":3,"maxChannelNumber":12`},
+		{"Channel count after changes", http.MethodGet, "/channels", "", "", http.StatusOK, `{"channelCount":3,"maxChannelNumber":12}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, testServer.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.expectedStatusCode {
+				t.Errorf("Expected status code %d, got %d: %s", tt.expectedStatusCode, resp.StatusCode, body)
+			}
+			if !strings.Contains(string(body), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %q", tt.expectedBody, body)
+			}
+			if resp.StatusCode == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Errorf("Expected a WWW-Authenticate header on 401 responses")
+			}
+		})
+	}
+
+	// The changes take effect on /post right away
+	results := httpServer.processDataPoints([]IncomingDataPoint{{ChannelNumber: 3, Value: json.Number("50"), Color: "#FF0000"}, {ChannelNumber: 12, Value: json.Number("50"), Color: "#FF0000"}}, "test")
+	if results[0].Status != DeliveryRejected {
+		t.Errorf("Expected deleted channel 3 to be rejected, got %+v", results[0])
+	}
+	if results[1].Status == DeliveryRejected {
+		t.Errorf("Expected added channel 12 to be accepted, got %+v", results[1])
+	}
+
+	// The configuration agrees with the channel map, leaving the one it replaced untouched
+	current, _ := httpServer.current()
+	channels := make(map[int]string)
+	for _, mapping := range current.ChannelMappings {
+		channels[mapping.ChannelNumber] = mapping.IntensityTopic
+	}
+	expected := map[int]string{1: "patched/intensity", 4: "par4/dimmer", 12: "ch12/intensity"}
+	if !reflect.DeepEqual(channels, expected) {
+		t.Errorf("Expected the configuration's channelMappings to be %v, got %v", expected, channels)
+	}
+	if len(cfg.ChannelMappings) != 2 || cfg.ChannelMappings[0].IntensityTopic != "ch1/intensity" {
+		t.Errorf("Expected the original configuration to be left alone, got %+v", cfg.ChannelMappings)
+	}
+}
+
+func TestChannelsAPIDisabledWithoutToken(t *testing.T) {
+	httpServer := NewHTTPServer(&Config{ChannelMappings: []ChannelMapping{{ChannelNumber: 1}}}, &MockMQTTClient{})
+	handler := httpServer.requireAPIToken(httpServer.handleChannelsRequest)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/channels", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	handler(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func TestWriteConfigChannel(t *testing.T) {
+	original := `# Lightboard bridge
+mqttBroker: "tcp://localhost:1883"
+
+channelMappings:
+  # Stage left
+  - channelNumber: 1
+    intensityTopic: "ch1/intensity" # dimmer
+    colorTopic: "ch1/color"
+    onOffTopic: "ch1/onoff"
+
+  - channelNumber: 2
+    intensityTopic: "ch2/intensity"
+    colorTopic: "ch2/color"
+    onOffTopic: "ch2/onoff"
+
+  - channelRange: "10-19"
+    intensityTopic: "wash/{n}/intensity"
+    colorTopic: "wash/{n}/color"
+    onOffTopic: "wash/{n}/onoff"
+
+# Web server
+httpListenAddr:   ":8080"
+`
+	// Only the entries written through the API change
+	expected := `# Lightboard bridge
+mqttBroker: "tcp://localhost:1883"
+
+channelMappings:
+  # Stage left
+  - channelNumber: 1
+    intensityTopic: patched/intensity
+    colorTopic: patched/color
+    onOffTopic: patched/onoff
+
+  - channelRange: "10-19"
+    intensityTopic: "wash/{n}/intensity"
+    colorTopic: "wash/{n}/color"
+    onOffTopic: "wash/{n}/onoff"
+  - channelNumber: 5
+    profile: par
+    id: par5
+  - channelNumber: 0
+    intensityTopic: ch0/intensity
+    colorTopic: ch0/color
+    onOffTopic: ch0/onoff
+
+# Web server
+httpListenAddr:   ":8080"
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(original), 0640); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	updated := ChannelMapping{ChannelNumber: 1, IntensityTopic: "patched/intensity", ColorTopic: "patched/color", OnOffTopic: "patched/onoff"}
+	if err := writeConfigChannel(configPath, 1, &updated); err != nil {
+		t.Fatalf("writeConfigChannel() unexpected error updating a channel: %v", err)
+	}
+	added := ChannelMapping{ChannelNumber: 5, Profile: "par", ID: "par5"}
+	if err := writeConfigChannel(configPath, 5, &added); err != nil {
+		t.Fatalf("writeConfigChannel() unexpected error adding a channel: %v", err)
+	}
+	if err := writeConfigChannel(configPath, 2, nil); err != nil {
+		t.Fatalf("writeConfigChannel() unexpected error removing a channel: %v", err)
+	}
+	zero := ChannelMapping{ChannelNumber: 0, IntensityTopic: "ch0/intensity", ColorTopic: "ch0/color", OnOffTopic: "ch0/onoff"}
+	if err := writeConfigChannel(configPath, 0, &zero); err != nil {
+		t.Fatalf("writeConfigChannel() unexpected error adding channel 0: %v", err)
+	}
+	err := writeConfigChannel(configPath, 12, &updated)
+	if err == nil || !strings.Contains(err.Error(), "generated by a channelRange entry") {
+		t.Errorf("Expected an error for a channel generated by a range, got %v", err)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read config file: %v", err)
+	}
+	if string(data) != expected {
+		t.Errorf("Expected the config file to read:\n%s\ngot:\n%s", expected, data)
+	}
+	if info, err := os.Stat(configPath); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("Expected the config file to keep its permissions, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	// The rewritten file still loads, up to the profile this test doesn't define
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), `unknown fixture profile "par"`) {
+		t.Errorf("Expected the rewritten file to load up to the missing profile, got %v", err)
+	}
+}
+
+func TestWriteConfigChannelWholeList(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		expected string
+	}{
+		{
+			name: "Flow style list",
+			original: `mqttBroker: "tcp://localhost:1883" # local
+channelMappings: [{channelNumber: 1, intensityTopic: ch1/intensity, colorTopic: ch1/color, onOffTopic: ch1/onoff}]
+httpListenAddr: ":8080"
+`,
+			expected: `mqttBroker: "tcp://localhost:1883" # local
+channelMappings:
+  - {channelNumber: 1, intensityTopic: ch1/intensity, colorTopic: ch1/color, onOffTopic: ch1/onoff}
+  - channelNumber: 2
+    intensityTopic: ch2/intensity
+    colorTopic: ch2/color
+    onOffTopic: ch2/onoff
+httpListenAddr: ":8080"
+`,
+		},
+		{
+			name: "Empty channel mappings",
+			original: `channelMappings: # none yet
+mqttBroker: "tcp://localhost:1883"
+`,
+			expected: `channelMappings:
+  - channelNumber: 2
+    intensityTopic: ch2/intensity
+    colorTopic: ch2/color
+    onOffTopic: ch2/onoff
+mqttBroker: "tcp://localhost:1883"
+`,
+		},
+		{
+			name:     "No channel mappings",
+			original: `mqttBroker: "tcp://localhost:1883" # local`,
+			expected: `mqttBroker: "tcp://localhost:1883" # local
+channelMappings:
+  - channelNumber: 2
+    intensityTopic: ch2/intensity
+    colorTopic: ch2/color
+    onOffTopic: ch2/onoff
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.original), 0644); err != nil {
+				t.Fatalf("Failed to write config file: %v", err)
+			}
+			added := ChannelMapping{ChannelNumber: 2, IntensityTopic: "ch2/intensity", ColorTopic: "ch2/color", OnOffTopic: "ch2/onoff"}
+			if err := writeConfigChannel(configPath, 2, &added); err != nil {
+				t.Fatalf("writeConfigChannel() unexpected error: %v", err)
+			}
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatalf("Failed to read config file: %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("Expected the config file to read:\n%s\ngot:\n%s", tt.expected, data)
+			}
+		})
+	}
+}
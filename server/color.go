@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RGB is a color with 8-bit components
+type RGB struct {
+	R, G, B uint8
+}
+
+// parseHexColor parses "#RGB" or "#RRGGBB" (the leading '#' is optional), as emitted
+// by the lightboard frontend
+func parseHexColor(s string) (RGB, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return RGB{}, fmt.Errorf("invalid color %q: expected #RGB or #RRGGBB", s)
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return RGB{}, fmt.Errorf("invalid color %q: expected #RGB or #RRGGBB", s)
+	}
+	return RGB{R: uint8(n >> 16), G: uint8(n >> 8), B: uint8(n)}, nil
+}
+
+// Color output formats for ChannelMapping.ColorFormat
+const (
+	ColorFormatAsReceived = ""         // The color string exactly as the client sent it
+	ColorFormatHex        = "hex"      // Normalized "#RRGGBB"
+	ColorFormatRGB        = "rgb"      // "255,128,0"
+	ColorFormatHSV        = "hsv"      // "30,100,100": hue in degrees, saturation and value in percent
+	ColorFormatHSB        = "hsb"      // Same as hsv
+	ColorFormatXY         = "xy"       // "0.5702,0.3927": CIE 1931 chromaticity, as used by Zigbee and Hue
+	ColorFormatJSONRGB    = "json-rgb" // {"r":255,"g":128,"b":0}
+	ColorFormatJSONHSV    = "json-hsv" // {"h":30,"s":100,"v":100}
+	ColorFormatJSONXY     = "json-xy"  // {"x":0.5702,"y":0.3927}
+	// Emitter levels for the channel's colorModel, dimmed by the intensity; see emitter.go
+	ColorFormatEmitters     = "emitters"      // "255,0,0,128"
+	ColorFormatJSONEmitters = "json-emitters" // {"red":255,"green":0,"blue":0,"white":128}
+)
+
+// validateColorFormat checks a ChannelMapping.ColorFormat value
+func validateColorFormat(format string) error {
+	switch format {
+	case ColorFormatAsReceived, ColorFormatHex, ColorFormatRGB, ColorFormatHSV, ColorFormatHSB,
+		ColorFormatXY, ColorFormatJSONRGB, ColorFormatJSONHSV, ColorFormatJSONXY, ColorFormatEmitters, ColorFormatJSONEmitters:
+		return nil
+	}
+	return fmt.Errorf("has invalid colorFormat %q: must be one of hex, rgb, hsv, hsb, xy, json-rgb, json-hsv, json-xy, emitters or json-emitters", format)
+}
+
+// Hex returns the color as "#RRGGBB"
+func (c RGB) Hex() string {
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// HSV returns the hue in degrees (0-360) and the saturation and value in percent (0-100)
+func (c RGB) HSV() (h, s, v float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	delta := max - min
+
+	if delta > 0 {
+		switch max {
+		case r:
+			h = 60 * math.Mod((g-b)/delta, 6)
+		case g:
+			h = 60 * ((b-r)/delta + 2)
+		default:
+			h = 60 * ((r-g)/delta + 4)
+		}
+		if h < 0 {
+			h += 360
+		}
+	}
+	if max > 0 {
+		s = delta / max * 100
+	}
+	return h, s, max * 100
+}
+
+// d65White is the chromaticity of the sRGB white point, used for black which has none
+var d65White = [2]float64{0.3127, 0.3290}
+
+// XY returns the CIE 1931 chromaticity of the sRGB color
+func (c RGB) XY() (x, y float64) {
+	linear := func(v uint8) float64 {
+		f := float64(v) / 255
+		if f <= 0.04045 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	r, g, b := linear(c.R), linear(c.G), linear(c.B)
+
+	// sRGB (D65) to CIE XYZ
+	X := 0.4124*r + 0.3576*g + 0.1805*b
+	Y := 0.2126*r + 0.7152*g + 0.0722*b
+	Z := 0.0193*r + 0.1192*g + 0.9505*b
+	sum := X + Y + Z
+	if sum == 0 {
+		return d65White[0], d65White[1]
+	}
+	return X / sum, Y / sum
+}
+
+// formatColor renders a parsed color in one of the ColorFormat representations.
+// received is the original string, returned unchanged for ColorFormatAsReceived.
+// The emitter formats are rendered by colorDecomposition.format instead.
+func formatColor(c RGB, received, format string) string {
+	switch format {
+	case ColorFormatHex:
+		return c.Hex()
+	case ColorFormatRGB:
+		return fmt.Sprintf("%d,%d,%d", c.R, c.G, c.B)
+	case ColorFormatHSV, ColorFormatHSB:
+		h, s, v := c.HSV()
+		return fmt.Sprintf("%d,%d,%d", int(math.Round(h))%360, int(math.Round(s)), int(math.Round(v)))
+	case ColorFormatXY:
+		x, y := c.XY()
+		return fmt.Sprintf("%.4f,%.4f", x, y)
+	case ColorFormatJSONRGB:
+		return fmt.Sprintf(`{"r":%d,"g":%d,"b":%d}`, c.R, c.G, c.B)
+	case ColorFormatJSONHSV:
+		h, s, v := c.HSV()
+		return fmt.Sprintf(`{"h":%d,"s":%d,"v":%d}`, int(math.Round(h))%360, int(math.Round(s)), int(math.Round(v)))
+	case ColorFormatJSONXY:
+		x, y := c.XY()
+		return fmt.Sprintf(`{"x":%.4f,"y":%.4f}`, x, y)
+	}
+	return received
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseHexColor(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    RGB
+		expectError bool
+	}{
+		{input: "#FF8000", expected: RGB{R: 255, G: 128, B: 0}},
+		{input: "#ff8000", expected: RGB{R: 255, G: 128, B: 0}},
+		{input: "FF8000", expected: RGB{R: 255, G: 128, B: 0}},
+		{input: "#F80", expected: RGB{R: 255, G: 136, B: 0}},
+		{input: "", expectError: true},
+		{input: "red", expectError: true},
+		{input: "#FF80", expectError: true},
+		{input: "#GG8000", expectError: true},
+		{input: "#FF8000FF", expectError: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseHexColor(tt.input)
+		if tt.expectError {
+			if err == nil {
+				t.Errorf("parseHexColor(%q) expected an error, but got %+v", tt.input, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.expected {
+			t.Errorf("parseHexColor(%q) got = %+v, %v, want %+v", tt.input, got, err, tt.expected)
+		}
+	}
+}
+
+func TestFormatColor(t *testing.T) {
+	orange := RGB{R: 255, G: 128, B: 0}
+	tests := []struct {
+		format   string
+		color    RGB
+		expected string
+	}{
+		{format: ColorFormatAsReceived, color: orange, expected: "#f80"},
+		{format: ColorFormatHex, color: orange, expected: "#FF8000"},
+		{format: ColorFormatRGB, color: orange, expected: "255,128,0"},
+		{format: ColorFormatHSV, color: orange, expected: "30,100,100"},
+		{format: ColorFormatHSB, color: RGB{R: 0, G: 0, B: 128}, expected: "240,100,50"},
+		{format: ColorFormatHSV, color: RGB{R: 255, G: 0, B: 64}, expected: "345,100,100"},
+		{format: ColorFormatHSV, color: RGB{R: 128, G: 128, B: 128}, expected: "0,0,50"},
+		{format: ColorFormatXY, color: RGB{R: 255}, expected: "0.6401,0.3300"},
+		{format: ColorFormatXY, color: RGB{G: 255}, expected: "0.3000,0.6000"},
+		{format: ColorFormatXY, color: RGB{B: 255}, expected: "0.1500,0.0600"},
+		{format: ColorFormatXY, color: RGB{R: 255, G: 255, B: 255}, expected: "0.3127,0.3290"},
+		{format: ColorFormatXY, color: RGB{}, expected: "0.3127,0.3290"},
+		{format: ColorFormatJSONRGB, color: orange, expected: `{"r":255,"g":128,"b":0}`},
+		{format: ColorFormatJSONHSV, color: orange, expected: `{"h":30,"s":100,"v":100}`},
+		{format: ColorFormatJSONXY, color: RGB{R: 255}, expected: `{"x":0.6401,"y":0.3300}`},
+	}
+
+	for _, tt := range tests {
+		got := formatColor(tt.color, "#f80", tt.format)
+		if got != tt.expected {
+			t.Errorf("formatColor(%+v, %q) got = %q, want %q", tt.color, tt.format, got, tt.expected)
+		}
+		if strings.HasPrefix(tt.format, "json-") && !json.Valid([]byte(got)) {
+			t.Errorf("formatColor(%+v, %q) is not valid JSON: %s", tt.color, tt.format, got)
+		}
+	}
+
+	if err := validateColorFormat("cmyk"); err == nil {
+		t.Error("validateColorFormat(\"cmyk\") expected an error, but got nil")
+	}
+}
+
+func TestColorFormatPublish(t *testing.T) {
+	cfg := &Config{
+		ChannelMappings: []ChannelMapping{
+			{ChannelNumber: 1, IntensityTopic: "ch1/intensity", ColorTopic: "ch1/color", OnOffTopic: "ch1/onoff", ColorFormat: ColorFormatRGB},
+			{ChannelNumber: 2, IntensityTopic: "ch2/intensity", ColorTopic: "ch2/color", OnOffTopic: "ch2/onoff",
+				ColorPayload: `{"color":{"x":{{printf "%.3f" .X}},"y":{{printf "%.3f" .Y}}},"hex":{{json .Hex}}}`},
+		},
+	}
+	mockMQTT := &MockMQTTClient{}
+	httpServer := NewHTTPServer(cfg, mockMQTT)
+
+	httpServer.processDataPoints([]IncomingDataPoint{
+		{ChannelNumber: 1, Value: json.Number("50"), Color: "#f80"},
+		{ChannelNumber: 2, Value: json.Number("50"), Color: "#ff0000"},
+	}, "test")
+
+	if !containsMessage(mockMQTT.PublishedMessages["ch1/color"], "255,136,0") {
+		t.Errorf("Expected rgb color on ch1/color, got %v", mockMQTT.PublishedMessages["ch1/color"])
+	}
+	if !containsMessage(mockMQTT.PublishedMessages["ch2/color"], `{"color":{"x":0.640,"y":0.330},"hex":"#FF0000"}`) {
+		t.Errorf("Expected templated xy color on ch2/color, got %v", mockMQTT.PublishedMessages["ch2/color"])
+	}
+}
@@ -1,67 +1,301 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config holds the application configuration
 type Config struct {
-	MQTTBroker     string           `yaml:"mqttBroker"`
-	HTTPListenAddr string           `yaml:"httpListenAddr"`
+	MQTTBroker      string           `yaml:"mqttBroker"`
+	HTTPListenAddr  string           `yaml:"httpListenAddr"`
 	ChannelMappings []ChannelMapping `yaml:"channelMappings"`
-	MQTTClientID   string           `yaml:"mqttClientId,omitempty"`
-	MQTTUsername   string           `yaml:"mqttUsername,omitempty"`
-	MQTTPassword   string           `yaml:"mqttPassword,omitempty"`
-	// Add other MQTT settings from sample if needed, e.g., QoS
-	// DefaultQoS byte `yaml:"qos,omitempty"`
+	MQTTClientID    string           `yaml:"mqttClientId,omitempty"`
+	MQTTUsername    string           `yaml:"mqttUsername,omitempty"`
+	MQTTPassword    string           `yaml:"mqttPassword,omitempty"`
+	// StateFile, if set, is where channel state is saved so it survives a restart
+	StateFile string `yaml:"stateFile,omitempty"`
+	// RepublishState publishes the restored state to all mapped topics on startup
+	RepublishState bool `yaml:"republishStateOnStartup,omitempty"`
+	// QoS and Retain are the defaults for every publish, unless a ChannelMapping overrides them
+	QoS    int  `yaml:"qos,omitempty"`
+	Retain bool `yaml:"retain,omitempty"`
+	// MQTTWill configures the bridge status topic: Last Will, birth and graceful offline messages
+	MQTTWill *MQTTWillConfig `yaml:"mqttWill,omitempty"`
+	// MQTTTLS configures certificates for ssl:// and mqtts:// brokers
+	MQTTTLS *MQTTTLSConfig `yaml:"mqttTls,omitempty"`
+	// MQTT connection tuning. Zero or unset values are replaced with defaults by LoadConfig.
+	MQTTKeepAliveSeconds            int   `yaml:"mqttKeepAliveSeconds,omitempty"`
+	MQTTPingTimeoutSeconds          int   `yaml:"mqttPingTimeoutSeconds,omitempty"`
+	MQTTConnectTimeoutSeconds       int   `yaml:"mqttConnectTimeoutSeconds,omitempty"`
+	MQTTAutoReconnect               *bool `yaml:"mqttAutoReconnect,omitempty"`
+	MQTTMaxReconnectIntervalSeconds int   `yaml:"mqttMaxReconnectIntervalSeconds,omitempty"`
+	MQTTCleanSession                *bool `yaml:"mqttCleanSession,omitempty"`
+	// MQTTConnectRetry keeps retrying the initial connection in the background instead of
+	// exiting when the broker isn't up yet
+	MQTTConnectRetry                *bool `yaml:"mqttConnectRetry,omitempty"`
+	MQTTConnectRetryIntervalSeconds int   `yaml:"mqttConnectRetryIntervalSeconds,omitempty"`
+	// MQTTConfirmPublish makes QoS 1 and 2 publishes wait for the broker's acknowledgement,
+	// so delivery failures are reported back to the HTTP client
+	MQTTConfirmPublish       bool `yaml:"mqttConfirmPublish,omitempty"`
+	MQTTPublishTimeoutMillis int  `yaml:"mqttPublishTimeoutMs,omitempty"`
+	// MQTTOfflineQueue holds the latest message per topic while the broker is unreachable
+	// and replays them on reconnect
+	MQTTOfflineQueue     *bool `yaml:"mqttOfflineQueue,omitempty"`
+	MQTTOfflineQueueSize int   `yaml:"mqttOfflineQueueSize,omitempty"`
+	// FixtureProfiles lists fixture profile files, or directories of them, that
+	// channelMappings entries can reference. Relative paths are relative to the config file.
+	FixtureProfiles []string `yaml:"fixtureProfiles,omitempty"`
+	// OFLTopicPattern is the topic prefix for fixtures imported from Open Fixture Library
+	// JSON files in fixtureProfiles; defaults to "lightboard/fixture/{id}"
+	OFLTopicPattern string `yaml:"oflTopicPattern,omitempty"`
+	// APIToken enables the /api/channels management API, for clients sending it as a
+	// bearer token in the Authorization header
+	APIToken string `yaml:"apiToken,omitempty"`
+	// APIWriteConfig writes channel changes made through the API back to the config file
+	APIWriteConfig bool `yaml:"apiWriteConfig,omitempty"`
+
+	profiles map[string]FixtureProfile // Loaded fixture profiles, for mappings added through the API
+}
+
+// MQTTWillConfig describes the bridge status topic. The broker publishes Payload as the
+// Last Will if the bridge disappears; the bridge itself publishes BirthPayload when it
+// connects and Payload when it disconnects gracefully.
+type MQTTWillConfig struct {
+	Topic        string `yaml:"topic"`
+	Payload      string `yaml:"payload,omitempty"`      // Defaults to "offline"
+	BirthPayload string `yaml:"birthPayload,omitempty"` // Defaults to "online"
+	QoS          int    `yaml:"qos,omitempty"`
+	Retained     *bool  `yaml:"retained,omitempty"` // Defaults to true so the status survives reconnecting subscribers
 }
 
 // ChannelMapping defines the mapping from an HTTP channel number to its respective MQTT topics
 type ChannelMapping struct {
-	ChannelNumber  int    `yaml:"channelNumber"`
-	IntensityTopic string `yaml:"intensityTopic"`
-	ColorTopic     string `yaml:"colorTopic"`
-	OnOffTopic     string `yaml:"onOffTopic"`
+	ChannelNumber int `yaml:"channelNumber,omitempty" json:"channelNumber"`
+	// Optional range like "1-48" generating one mapping per channel instead of ChannelNumber;
+	// {n} in topics and id is replaced with each channel number
+	ChannelRange string `yaml:"channelRange,omitempty" json:"channelRange,omitempty"`
+	// Optional fixture profile providing defaults for every other setting, and the
+	// instance id substituted for {id} in the profile's topics
+	Profile        string `yaml:"profile,omitempty" json:"profile,omitempty"`
+	ID             string `yaml:"id,omitempty" json:"id,omitempty"`
+	IntensityTopic string `yaml:"intensityTopic" json:"intensityTopic,omitempty"`
+	ColorTopic     string `yaml:"colorTopic" json:"colorTopic,omitempty"`
+	OnOffTopic     string `yaml:"onOffTopic" json:"onOffTopic,omitempty"`
+	// Optional per-topic overrides of the global qos and retain settings
+	IntensityQoS    *int  `yaml:"intensityQos,omitempty" json:"intensityQos,omitempty"`
+	IntensityRetain *bool `yaml:"intensityRetain,omitempty" json:"intensityRetain,omitempty"`
+	ColorQoS        *int  `yaml:"colorQos,omitempty" json:"colorQos,omitempty"`
+	ColorRetain     *bool `yaml:"colorRetain,omitempty" json:"colorRetain,omitempty"`
+	OnOffQoS        *int  `yaml:"onOffQos,omitempty" json:"onOffQos,omitempty"`
+	OnOffRetain     *bool `yaml:"onOffRetain,omitempty" json:"onOffRetain,omitempty"`
+	// Optional text/template payload formats per topic; see PayloadData for the available fields
+	IntensityPayload string `yaml:"intensityPayload,omitempty" json:"intensityPayload,omitempty"`
+	ColorPayload     string `yaml:"colorPayload,omitempty" json:"colorPayload,omitempty"`
+	OnOffPayload     string `yaml:"onOffPayload,omitempty" json:"onOffPayload,omitempty"`
+	// Optional scaling of the intensity value from the input range (default 0-100) to the
+	// output range (default: same as input), applied before payload formatting
+	InputMin  *float64 `yaml:"inputMin,omitempty" json:"inputMin,omitempty"`
+	InputMax  *float64 `yaml:"inputMax,omitempty" json:"inputMax,omitempty"`
+	OutputMin *float64 `yaml:"outputMin,omitempty" json:"outputMin,omitempty"`
+	OutputMax *float64 `yaml:"outputMax,omitempty" json:"outputMax,omitempty"`
+	Rounding  string   `yaml:"rounding,omitempty" json:"rounding,omitempty"` // "round", "floor", "ceil" or "truncate"; empty keeps decimals
+	Clamp     *bool    `yaml:"clamp,omitempty" json:"clamp,omitempty"`       // Clamp values outside the input range; defaults to true if a range is set
+	// Optional dimmer curve applied to the intensity before scaling to the output range
+	Curve      string    `yaml:"curve,omitempty" json:"curve,omitempty"`           // linear (default), square, inverse-square, gamma, s-curve or table
+	Gamma      float64   `yaml:"gamma,omitempty" json:"gamma,omitempty"`           // Exponent for the gamma curve; defaults to 2.2
+	CurveTable []float64 `yaml:"curveTable,omitempty" json:"curveTable,omitempty"` // Output levels (0-1) at evenly spaced inputs, for the table curve
+	// Optional representation of the color published to colorTopic; passed through as received if empty
+	ColorFormat string `yaml:"colorFormat,omitempty" json:"colorFormat,omitempty"` // hex, rgb, hsv, hsb, xy, json-rgb, json-hsv, json-xy, emitters or json-emitters
+	// Optional fixture color model; the color is split into per-emitter levels, dimmed by the intensity
+	ColorModel      string            `yaml:"colorModel,omitempty" json:"colorModel,omitempty"`           // rgb (default), rgbw, rgba, rgbwa or rgbwauv
+	WhiteExtraction string            `yaml:"whiteExtraction,omitempty" json:"whiteExtraction,omitempty"` // min (default), calibrated or none
+	WhitePoint      string            `yaml:"whitePoint,omitempty" json:"whitePoint,omitempty"`           // Hex color of the white emitter, for calibrated extraction
+	AmberPoint      string            `yaml:"amberPoint,omitempty" json:"amberPoint,omitempty"`           // Hex color of the amber emitter; defaults to #FFBF00
+	UVPoint         string            `yaml:"uvPoint,omitempty" json:"uvPoint,omitempty"`                 // Hex color the UV emitter is treated as; defaults to #8000FF
+	EmitterTopics   map[string]string `yaml:"emitterTopics,omitempty" json:"emitterTopics,omitempty"`     // Emitter name to topic, each receiving its 0-255 level
+	EmitterDimming  *bool             `yaml:"emitterDimming,omitempty" json:"emitterDimming,omitempty"`   // Whether emitter levels follow the intensity; defaults to true
+	// Optional color temperature topic for tunable-white fixtures
+	CCTTopic   string   `yaml:"cctTopic,omitempty" json:"cctTopic,omitempty"`
+	CCTQoS     *int     `yaml:"cctQos,omitempty" json:"cctQos,omitempty"`
+	CCTRetain  *bool    `yaml:"cctRetain,omitempty" json:"cctRetain,omitempty"`
+	CCTPayload string   `yaml:"cctPayload,omitempty" json:"cctPayload,omitempty"`
+	CCTUnit    string   `yaml:"cctUnit,omitempty" json:"cctUnit,omitempty"` // kelvin (default) or mired
+	CCTMin     *float64 `yaml:"cctMin,omitempty" json:"cctMin,omitempty"`   // Fixture's warmest color temperature in Kelvin; defaults to 1000
+	CCTMax     *float64 `yaml:"cctMax,omitempty" json:"cctMax,omitempty"`   // Fixture's coolest color temperature in Kelvin; defaults to 40000
+	// Optional approximation of the color temperature from the color for data points without
+	// a kelvin, for white-only fixtures. Off by default, since on RGB+CCT fixtures the derived
+	// temperature would override the color.
+	CCTFromColor *bool `yaml:"cctFromColor,omitempty" json:"cctFromColor,omitempty"`
 }
 
-// LoadConfig reads the configuration file from the given path
-func LoadConfig(configPath string) (*Config, error) {
-	if configPath == "" {
-		return nil, fmt.Errorf("configuration file path cannot be empty")
+// ConfigError lists every problem found in a configuration file, so they can all be
+// fixed in one go rather than one restart at a time
+type ConfigError struct {
+	Problems []error
+}
+
+func (e *ConfigError) Error() string {
+	if len(e.Problems) == 1 {
+		return e.Problems[0].Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d problems:", len(e.Problems))
+	for _, problem := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(problem.Error())
 	}
+	return b.String()
+}
 
-	configFile, err := os.ReadFile(configPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file '%s': %w", configPath, err)
+func (e *ConfigError) Unwrap() []error {
+	return e.Problems
+}
+
+// add records err as a problem, unpacking errors joined with errors.Join
+func (e *ConfigError) add(err error) {
+	if err == nil {
+		return
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			e.add(err)
+		}
+		return
+	}
+	e.Problems = append(e.Problems, err)
+}
+
+// LoadConfig reads the configuration file from the given path. ${VAR} references in the
+// file are expanded first; LIGHTBOARD_* environment variables then override the file's
+// settings, and overrides ("path=value", as given with -set) override those in turn.
+// Without a path, all settings come from the environment and overrides.
+// Unknown fields are rejected, and every problem found is reported in a *ConfigError.
+func LoadConfig(configPath string, overrides ...string) (*Config, error) {
+	configFile := []byte{}
+	if configPath != "" {
+		var err error
+		if configFile, err = os.ReadFile(configPath); err != nil {
+			return nil, fmt.Errorf("failed to read config file '%s': %w", configPath, err)
+		}
 	}
 
 	var config Config
-	err = yaml.Unmarshal(configFile, &config)
-	if err != nil {
+	var problems ConfigError
+	expanded, lines, err := expandEnvReferences(configFile, os.LookupEnv)
+	if expanded == nil {
 		return nil, fmt.Errorf("failed to unmarshal config file '%s': %w", configPath, err)
 	}
+	problems.add(err)
+	decoder := yaml.NewDecoder(bytes.NewReader(expanded))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		// Unknown fields and type mismatches leave the rest of the file decoded, so
+		// validation carries on to report the remaining problems too
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, fmt.Errorf("failed to unmarshal config file '%s': %w", configPath, err)
+		}
+		for _, problem := range typeErr.Errors {
+			problems.add(errors.New(sourceLine(problem, lines)))
+		}
+	}
+
+	problems.add(applyEnvOverrides(&config, os.LookupEnv))
+	problems.add(applySetOverrides(&config, overrides))
 
 	// Basic validation
 	if config.MQTTBroker == "" {
-		return nil, fmt.Errorf("mqttBroker must be set in the configuration")
+		problems.add(fmt.Errorf("mqttBroker must be set in the configuration"))
+	} else {
+		problems.add(validateBrokerURL(config.MQTTBroker))
 	}
 	if config.HTTPListenAddr == "" {
 		// Default if not set
 		config.HTTPListenAddr = ":8080"
 		fmt.Printf("httpListenAddr not set, defaulting to %s\n", config.HTTPListenAddr)
+	} else {
+		problems.add(validateListenAddr(config.HTTPListenAddr))
 	}
 	if len(config.ChannelMappings) == 0 {
-		return nil, fmt.Errorf("at least one channelMapping must be configured")
+		problems.add(fmt.Errorf("at least one channelMapping must be configured"))
 	}
-	for i, cm := range config.ChannelMappings {
-		// ChannelNumber is int, so no check for empty string. 0 could be a valid channel number.
-		// We need to ensure that topics are set if the user intends to use them.
-		// For this version, let's assume all three topics are mandatory if a mapping is provided.
-		if cm.IntensityTopic == "" || cm.ColorTopic == "" || cm.OnOffTopic == "" {
-			return nil, fmt.Errorf("channelMapping for channelNumber %d (at index %d) must have intensityTopic, colorTopic, and onOffTopic set", cm.ChannelNumber, i)
+	oflTopicPattern := config.OFLTopicPattern
+	if oflTopicPattern == "" {
+		oflTopicPattern = defaultOFLTopicPattern
+	}
+	profiles, profilesErr := loadFixtureProfiles(config.FixtureProfiles, filepath.Dir(configPath), oflTopicPattern)
+	problems.add(profilesErr)
+	mappings, sources, err := generateChannelMappings(config.ChannelMappings)
+	problems.add(err)
+	mappedAt := make(map[int]int) // Channel number to the index of the entry mapping it
+	for i, cm := range mappings {
+		index := sources[i]
+		if previous, ok := mappedAt[cm.ChannelNumber]; ok {
+			problems.add(fmt.Errorf("channelNumber %d is mapped more than once (at index %d and %d)", cm.ChannelNumber, previous, index))
+			continue
+		}
+		mappedAt[cm.ChannelNumber] = index
+		if cm.Profile != "" && profilesErr != nil {
+			continue // Already reported; the profile may well be fine
+		}
+
+		resolved, err := resolveChannelMapping(cm, profiles)
+		if err != nil {
+			problems.add(fmt.Errorf("channelMapping for channelNumber %d (at index %d) %w", cm.ChannelNumber, index, err))
+			continue
+		}
+		mappings[i] = resolved
+	}
+	config.ChannelMappings = mappings
+	if len(profiles) > 0 {
+		config.profiles = profiles
+	}
+	if !validQoS(config.QoS) {
+		problems.add(fmt.Errorf("qos must be 0, 1 or 2, got %d", config.QoS))
+	}
+	problems.add(applyMQTTTuningDefaults(&config))
+	if config.MQTTWill != nil {
+		if config.MQTTWill.Topic == "" {
+			problems.add(fmt.Errorf("mqttWill.topic must be set when mqttWill is configured"))
+		} else if hasTopicWildcard(config.MQTTWill.Topic) {
+			problems.add(fmt.Errorf("mqttWill.topic '%s' must not contain the wildcards + or #", config.MQTTWill.Topic))
+		}
+		if !validQoS(config.MQTTWill.QoS) {
+			problems.add(fmt.Errorf("mqttWill.qos must be 0, 1 or 2, got %d", config.MQTTWill.QoS))
+		}
+		if config.MQTTWill.Payload == "" {
+			config.MQTTWill.Payload = "offline"
+		}
+		if config.MQTTWill.BirthPayload == "" {
+			config.MQTTWill.BirthPayload = "online"
+		}
+		if config.MQTTWill.Retained == nil {
+			retained := true
+			config.MQTTWill.Retained = &retained
+		}
+	}
+	if config.MQTTTLS != nil {
+		if !isTLSBroker(config.MQTTBroker) {
+			problems.add(fmt.Errorf("mqttTls is configured but mqttBroker '%s' does not use a TLS scheme (e.g. ssl:// or mqtts://)", config.MQTTBroker))
+		}
+		if _, err := buildTLSConfig(config.MQTTTLS); err != nil {
+			problems.add(err)
+		}
+	}
+	if config.StateFile != "" {
+		if info, err := os.Stat(filepath.Dir(config.StateFile)); err != nil || !info.IsDir() {
+			problems.add(fmt.Errorf("directory for stateFile '%s' does not exist", config.StateFile))
 		}
 	}
 	if config.MQTTClientID == "" {
@@ -69,5 +303,194 @@ func LoadConfig(configPath string) (*Config, error) {
 		fmt.Printf("mqttClientId not set, defaulting to %s\n", config.MQTTClientID)
 	}
 
+	if len(problems.Problems) > 0 {
+		return nil, &problems
+	}
 	return &config, nil
 }
+
+// configSource describes where LoadConfig reads the configuration from, for messages
+func configSource(configPath string) string {
+	if configPath == "" {
+		return "the environment and -set flags"
+	}
+	return "'" + configPath + "'"
+}
+
+// plainBrokerSchemes are the broker URL schemes paho connects to without TLS
+var plainBrokerSchemes = []string{"tcp", "mqtt", "ws", "unix"}
+
+// validateBrokerURL checks that paho can connect to the broker URL, which otherwise
+// only fails once the bridge tries to connect
+func validateBrokerURL(broker string) error {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return fmt.Errorf("mqttBroker '%s' is not a valid URL: %w", broker, err)
+	}
+	if u.Scheme == "" {
+		return fmt.Errorf("mqttBroker '%s' must include a scheme, e.g. tcp://localhost:1883", broker)
+	}
+	if !slices.Contains(plainBrokerSchemes, strings.ToLower(u.Scheme)) && !isTLSBroker(broker) {
+		return fmt.Errorf("mqttBroker '%s' has unsupported scheme %q: must be one of %s", broker, u.Scheme, strings.Join(append(slices.Clone(plainBrokerSchemes), tlsBrokerSchemes...), ", "))
+	}
+	if strings.EqualFold(u.Scheme, "unix") {
+		if u.Path == "" {
+			return fmt.Errorf("mqttBroker '%s' must include a socket path", broker)
+		}
+	} else if u.Host == "" {
+		return fmt.Errorf("mqttBroker '%s' must include a host, e.g. tcp://localhost:1883", broker)
+	}
+	return nil
+}
+
+// validateListenAddr checks that the HTTP server can listen on addr, e.g. ":8080"
+func validateListenAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("httpListenAddr '%s' is invalid: %w", addr, err)
+	}
+	if _, err := net.LookupPort("tcp", port); err != nil {
+		return fmt.Errorf("httpListenAddr '%s' has invalid port %q", addr, port)
+	}
+	return nil
+}
+
+// hasTopicWildcard reports whether a topic contains the subscription wildcards + or #,
+// which brokers refuse in topics being published to
+func hasTopicWildcard(topic string) bool {
+	return strings.ContainsAny(topic, "+#")
+}
+
+// resolveChannelMapping expands a channelMappings entry with its fixture profile and
+// checks the result, giving the mapping used at runtime
+func resolveChannelMapping(cm ChannelMapping, profiles map[string]FixtureProfile) (ChannelMapping, error) {
+	resolved, err := expandChannelMapping(cm, profiles)
+	if err != nil {
+		return cm, err
+	}
+	if err := validateChannelMapping(resolved); err != nil {
+		return cm, err
+	}
+	return resolved, nil
+}
+
+// validateChannelMapping checks a single channel mapping. Errors are phrased to follow
+// a description of the mapping, e.g. "channelMapping for channelNumber 1 must have ..."
+func validateChannelMapping(cm ChannelMapping) error {
+	// ChannelNumber is int, so no check for empty string. 0 could be a valid channel number.
+	// We need to ensure that topics are set if the user intends to use them.
+	// For this version, let's assume all three topics are mandatory if a mapping is provided.
+	if cm.IntensityTopic == "" || cm.ColorTopic == "" || cm.OnOffTopic == "" {
+		return fmt.Errorf("must have intensityTopic, colorTopic, and onOffTopic set")
+	}
+	topics := map[string]string{
+		"intensityTopic": cm.IntensityTopic,
+		"colorTopic":     cm.ColorTopic,
+		"onOffTopic":     cm.OnOffTopic,
+		"cctTopic":       cm.CCTTopic,
+	}
+	for emitter, topic := range cm.EmitterTopics {
+		topics["emitterTopics."+emitter] = topic
+	}
+	for _, name := range sortedKeys(topics) {
+		if hasTopicWildcard(topics[name]) {
+			return fmt.Errorf("has %s '%s' containing the wildcards + or #, which can't be published to", name, topics[name])
+		}
+	}
+	for _, setting := range []struct {
+		name string
+		qos  *int
+	}{
+		{"intensityQos", cm.IntensityQoS},
+		{"colorQos", cm.ColorQoS},
+		{"onOffQos", cm.OnOffQoS},
+		{"cctQos", cm.CCTQoS},
+	} {
+		if setting.qos != nil && !validQoS(*setting.qos) {
+			return fmt.Errorf("has invalid %s %d: must be 0, 1 or 2", setting.name, *setting.qos)
+		}
+	}
+	for _, payload := range []struct{ name, template string }{
+		{"intensityPayload", cm.IntensityPayload},
+		{"colorPayload", cm.ColorPayload},
+		{"onOffPayload", cm.OnOffPayload},
+		{"cctPayload", cm.CCTPayload},
+	} {
+		if payload.template == "" {
+			continue
+		}
+		if _, err := parsePayloadTemplate(payload.template); err != nil {
+			return fmt.Errorf("has invalid %s: %w", payload.name, err)
+		}
+	}
+	if err := cm.scaling().validate(); err != nil {
+		return err
+	}
+	if err := validateColorFormat(cm.ColorFormat); err != nil {
+		return err
+	}
+	if _, err := cm.decomposition(); err != nil {
+		return err
+	}
+	if err := cm.cct().validate(); err != nil {
+		return err
+	}
+	if cm.CCTFromColor != nil && *cm.CCTFromColor && cm.CCTTopic == "" {
+		return fmt.Errorf("has cctFromColor set but no cctTopic")
+	}
+	return nil
+}
+
+// applyMQTTTuningDefaults fills in unset MQTT tuning options and checks that the rest are in range
+func applyMQTTTuningDefaults(config *Config) error {
+	var errs []error
+	intSettings := []struct {
+		name     string
+		value    *int
+		def      int
+		min, max int
+	}{
+		{"mqttKeepAliveSeconds", &config.MQTTKeepAliveSeconds, 60, 1, 65535}, // MQTT keep alive is a 16-bit field
+		{"mqttPingTimeoutSeconds", &config.MQTTPingTimeoutSeconds, 5, 1, 300},
+		{"mqttConnectTimeoutSeconds", &config.MQTTConnectTimeoutSeconds, 10, 1, 300},
+		{"mqttMaxReconnectIntervalSeconds", &config.MQTTMaxReconnectIntervalSeconds, 60, 1, 3600},
+		{"mqttConnectRetryIntervalSeconds", &config.MQTTConnectRetryIntervalSeconds, 5, 1, 300},
+		{"mqttPublishTimeoutMs", &config.MQTTPublishTimeoutMillis, 2000, 1, 60000},
+		{"mqttOfflineQueueSize", &config.MQTTOfflineQueueSize, 1000, 1, 100000},
+	}
+	for _, setting := range intSettings {
+		if *setting.value == 0 {
+			*setting.value = setting.def
+		} else if *setting.value < setting.min || *setting.value > setting.max {
+			errs = append(errs, fmt.Errorf("%s must be between %d and %d, got %d", setting.name, setting.min, setting.max, *setting.value))
+		}
+	}
+	if config.MQTTPingTimeoutSeconds >= config.MQTTKeepAliveSeconds {
+		errs = append(errs, fmt.Errorf("mqttPingTimeoutSeconds (%d) must be less than mqttKeepAliveSeconds (%d)", config.MQTTPingTimeoutSeconds, config.MQTTKeepAliveSeconds))
+	}
+
+	for _, setting := range []**bool{&config.MQTTAutoReconnect, &config.MQTTCleanSession, &config.MQTTConnectRetry, &config.MQTTOfflineQueue} {
+		if *setting == nil {
+			enabled := true
+			*setting = &enabled
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validQoS(qos int) bool {
+	return qos >= 0 && qos <= 2
+}
+
+// publishSettings resolves the QoS and retain flag for a topic, applying the
+// per-topic overrides (which may be nil) on top of the global defaults
+func (c *Config) publishSettings(qos *int, retain *bool) (byte, bool) {
+	resolvedQoS, resolvedRetain := c.QoS, c.Retain
+	if qos != nil {
+		resolvedQoS = *qos
+	}
+	if retain != nil {
+		resolvedRetain = *retain
+	}
+	return byte(resolvedQoS), resolvedRetain
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -137,6 +139,249 @@ channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOff
 				MQTTClientID: "lightboard-http-bridge", // Default
 			},
 		},
+		{
+			name: "Config with stateFile in a missing directory",
+			configPath: createTempFile("missing_state_dir.yaml", `
+mqttBroker: "tcp://localhost:1883"
+stateFile: "/nonexistent/dir/state.json"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with QoS and retain overrides",
+			configPath: createTempFile("qos_overrides.yaml", `
+mqttBroker: "tcp://localhost:1883"
+qos: 1
+retain: true
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o", intensityRetain: false, onOffQos: 2}]`),
+			expectError: false,
+			expectedCfg: &Config{
+				MQTTBroker:     "tcp://localhost:1883",
+				HTTPListenAddr: ":8080",
+				ChannelMappings: []ChannelMapping{
+					{ChannelNumber: 1, IntensityTopic: "i", ColorTopic: "c", OnOffTopic: "o", IntensityRetain: boolPtr(false), OnOffQoS: intPtr(2)},
+				},
+				MQTTClientID: "lightboard-http-bridge",
+				QoS:          1,
+				Retain:       true,
+			},
+		},
+		{
+			name: "Config with invalid global QoS",
+			configPath: createTempFile("invalid_qos.yaml", `
+mqttBroker: "tcp://localhost:1883"
+qos: 3
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with invalid per-topic QoS",
+			configPath: createTempFile("invalid_topic_qos.yaml", `
+mqttBroker: "tcp://localhost:1883"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o", colorQos: -1}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with MQTT will defaults",
+			configPath: createTempFile("will_defaults.yaml", `
+mqttBroker: "tcp://localhost:1883"
+mqttWill: {topic: "lightboard/bridge/status", qos: 1}
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`),
+			expectError: false,
+			expectedCfg: &Config{
+				MQTTBroker:     "tcp://localhost:1883",
+				HTTPListenAddr: ":8080",
+				ChannelMappings: []ChannelMapping{
+					{ChannelNumber: 1, IntensityTopic: "i", ColorTopic: "c", OnOffTopic: "o"},
+				},
+				MQTTClientID: "lightboard-http-bridge",
+				MQTTWill: &MQTTWillConfig{
+					Topic:        "lightboard/bridge/status",
+					Payload:      "offline",
+					BirthPayload: "online",
+					QoS:          1,
+					Retained:     boolPtr(true),
+				},
+			},
+		},
+		{
+			name: "Config with MQTT will missing topic",
+			configPath: createTempFile("will_no_topic.yaml", `
+mqttBroker: "tcp://localhost:1883"
+mqttWill: {payload: "gone"}
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with mqttTls on a plaintext broker",
+			configPath: createTempFile("tls_plaintext.yaml", `
+mqttBroker: "tcp://localhost:1883"
+mqttTls: {insecureSkipVerify: true}
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with mqttTls and a missing CA file",
+			configPath: createTempFile("tls_missing_ca.yaml", `
+mqttBroker: "ssl://localhost:8883"
+mqttTls: {caFile: "/nonexistent/ca.pem"}
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with MQTT tuning options",
+			configPath: createTempFile("mqtt_tuning.yaml", `
+mqttBroker: "tcp://localhost:1883"
+mqttKeepAliveSeconds: 30
+mqttPingTimeoutSeconds: 10
+mqttConnectTimeoutSeconds: 3
+mqttAutoReconnect: false
+mqttMaxReconnectIntervalSeconds: 120
+mqttCleanSession: false
+mqttConnectRetry: false
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`),
+			expectError: false,
+			expectedCfg: &Config{
+				MQTTBroker:     "tcp://localhost:1883",
+				HTTPListenAddr: ":8080",
+				ChannelMappings: []ChannelMapping{
+					{ChannelNumber: 1, IntensityTopic: "i", ColorTopic: "c", OnOffTopic: "o"},
+				},
+				MQTTClientID:                    "lightboard-http-bridge",
+				MQTTKeepAliveSeconds:            30,
+				MQTTPingTimeoutSeconds:          10,
+				MQTTConnectTimeoutSeconds:       3,
+				MQTTAutoReconnect:               boolPtr(false),
+				MQTTMaxReconnectIntervalSeconds: 120,
+				MQTTCleanSession:                boolPtr(false),
+				MQTTConnectRetry:                boolPtr(false),
+			},
+		},
+		{
+			name: "Config with out of range keep alive",
+			configPath: createTempFile("invalid_keepalive.yaml", `
+mqttBroker: "tcp://localhost:1883"
+mqttKeepAliveSeconds: 70000
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with ping timeout longer than keep alive",
+			configPath: createTempFile("invalid_ping_timeout.yaml", `
+mqttBroker: "tcp://localhost:1883"
+mqttKeepAliveSeconds: 5
+mqttPingTimeoutSeconds: 10
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with negative connect timeout",
+			configPath: createTempFile("invalid_connect_timeout.yaml", `
+mqttBroker: "tcp://localhost:1883"
+mqttConnectTimeoutSeconds: -1
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with invalid payload template",
+			configPath: createTempFile("invalid_payload_template.yaml", `
+mqttBroker: "tcp://localhost:1883"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o", onOffPayload: "{{.State}}"}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with empty output range",
+			configPath: createTempFile("empty_output_range.yaml", `
+mqttBroker: "tcp://localhost:1883"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o", outputMin: 255, outputMax: 255}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with decreasing curve table",
+			configPath: createTempFile("decreasing_curve_table.yaml", `
+mqttBroker: "tcp://localhost:1883"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o", curve: table, curveTable: [0, 0.8, 0.5, 1]}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with unknown color format",
+			configPath: createTempFile("unknown_color_format.yaml", `
+mqttBroker: "tcp://localhost:1883"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o", colorFormat: cmyk}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with emitter topic outside the color model",
+			configPath: createTempFile("emitter_outside_color_model.yaml", `
+mqttBroker: "tcp://localhost:1883"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o", colorModel: rgbw, emitterTopics: {amber: "a"}}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with inverted CCT range",
+			configPath: createTempFile("inverted_cct_range.yaml", `
+mqttBroker: "tcp://localhost:1883"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o", cctTopic: "k", cctMin: 6500, cctMax: 2700}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with cctFromColor but no cctTopic",
+			configPath: createTempFile("cct_from_color_without_topic.yaml", `
+mqttBroker: "tcp://localhost:1883"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o", cctFromColor: true}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with misspelt field",
+			configPath: createTempFile("misspelt_field.yaml", `
+mqttBroker: "tcp://localhost:1883"
+channelMappings: [{channelNumber: 1, intesityTopic: "i", intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with wildcard in a publish topic",
+			configPath: createTempFile("wildcard_topic.yaml", `
+mqttBroker: "tcp://localhost:1883"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c/#", onOffTopic: "o"}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with wildcard in an emitter topic",
+			configPath: createTempFile("wildcard_emitter_topic.yaml", `
+mqttBroker: "tcp://localhost:1883"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o", emitterTopics: {red: "+/red"}}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with unsupported broker scheme",
+			configPath: createTempFile("unsupported_broker_scheme.yaml", `
+mqttBroker: "http://localhost:1883"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with broker missing a scheme",
+			configPath: createTempFile("broker_missing_scheme.yaml", `
+mqttBroker: "localhost:1883"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with invalid listen address",
+			configPath: createTempFile("invalid_listen_addr.yaml", `
+mqttBroker: "tcp://localhost:1883"
+httpListenAddr: "8080"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`),
+			expectError: true,
+		},
+		{
+			name: "Config with out of range listen port",
+			configPath: createTempFile("out_of_range_listen_port.yaml", `
+mqttBroker: "tcp://localhost:1883"
+httpListenAddr: ":70000"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`),
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -151,10 +396,80 @@ channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOff
 				if err != nil {
 					t.Errorf("LoadConfig() unexpected error: %v", err)
 				}
-				if !reflect.DeepEqual(cfg, tt.expectedCfg) {
+				if !reflect.DeepEqual(cfg, withMQTTDefaults(tt.expectedCfg)) {
 					t.Errorf("LoadConfig() got = %v, want %v", cfg, tt.expectedCfg)
 				}
 			}
 		})
 	}
 }
+
+func TestLoadConfigReportsAllProblems(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+mqttBroker: "tcp//localhost:1883"
+httpListenAddr: "localhost"
+intesityTopic: "i"
+qos: 3
+channelMappings:
+  - channelNumber: 1
+    intensityTopic: "a/+/intensity"
+    colorTopic: "a/color"
+    onOffTopic: "a/onoff"
+  - channelNumber: 1
+    intensityTopic: "b/intensity"
+    colorTopic: "b/color"
+    onOffTopic: "b/onoff"
+  - channelRange: "9-1"
+    intensityTopic: "c/{n}/intensity"
+    colorTopic: "c/{n}/color"
+    onOffTopic: "c/{n}/onoff"
+mqttKeepAliveSeconds: 70000
+mqttPublishTimeoutMs: -1
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	_, err := LoadConfig(configPath)
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("LoadConfig() error = %v, want a *ConfigError", err)
+	}
+
+	expected := []string{
+		"field intesityTopic not found",
+		"mqttBroker 'tcp//localhost:1883' must include a scheme",
+		"httpListenAddr 'localhost' is invalid",
+		"channelMapping at index 2 has invalid channelRange",
+		"intensityTopic 'a/+/intensity' containing the wildcards",
+		"channelNumber 1 is mapped more than once (at index 0 and 1)",
+		"qos must be 0, 1 or 2",
+		"mqttKeepAliveSeconds must be between",
+		"mqttPublishTimeoutMs must be between",
+	}
+	if len(configErr.Problems) != len(expected) {
+		t.Errorf("LoadConfig() reported %d problems, want %d:\n%v", len(configErr.Problems), len(expected), err)
+	}
+	for _, want := range expected {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadConfig() error does not mention %q:\n%v", want, err)
+		}
+	}
+}
+
+// withMQTTDefaults fills in the MQTT tuning defaults LoadConfig applies, so test cases
+// only need to spell out the options they actually set
+func withMQTTDefaults(cfg *Config) *Config {
+	if cfg == nil {
+		return nil
+	}
+	withDefaults := *cfg
+	if err := applyMQTTTuningDefaults(&withDefaults); err != nil {
+		panic(err)
+	}
+	return &withDefaults
+}
+
+func intPtr(i int) *int    { return &i }
+func boolPtr(b bool) *bool { return &b }
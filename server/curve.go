@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Dimmer curves, applied to the normalized (0-1) intensity before it is scaled to the output range
+const (
+	CurveLinear        = "linear"
+	CurveSquare        = "square"         // Slow start, like an incandescent lamp: x²
+	CurveInverseSquare = "inverse-square" // Fast start: √x, the inverse of square
+	CurveGamma         = "gamma"          // x^gamma
+	CurveSCurve        = "s-curve"        // Gentle at both ends: smoothstep, 3x² - 2x³
+	CurveTable         = "table"          // User-supplied lookup table, linearly interpolated
+)
+
+// defaultGamma is used by the gamma curve when no exponent is configured
+const defaultGamma = 2.2
+
+// dimmerCurve maps a normalized level in 0-1 to a normalized output level. Every
+// built-in curve is monotonic and maps 0 to 0 and 1 to 1.
+type dimmerCurve struct {
+	kind  string
+	gamma float64
+	table []float64 // Output levels at evenly spaced inputs from 0 to 1
+}
+
+// curve resolves the mapping's curve settings, applying defaults
+func (cm ChannelMapping) curve() dimmerCurve {
+	c := dimmerCurve{kind: cm.Curve, gamma: cm.Gamma, table: cm.CurveTable}
+	if c.kind == "" {
+		c.kind = CurveLinear
+	}
+	if c.gamma == 0 {
+		c.gamma = defaultGamma
+	}
+	return c
+}
+
+// validate checks the curve settings
+func (c dimmerCurve) validate() error {
+	switch c.kind {
+	case CurveLinear, CurveSquare, CurveInverseSquare, CurveSCurve:
+	case CurveGamma:
+		if c.gamma <= 0 || math.IsNaN(c.gamma) || math.IsInf(c.gamma, 0) {
+			return fmt.Errorf("has invalid gamma %v: must be a positive number", c.gamma)
+		}
+	case CurveTable:
+		if len(c.table) < 2 {
+			return fmt.Errorf("has a curveTable with %d entries: at least 2 are required", len(c.table))
+		}
+		for i, level := range c.table {
+			if level < 0 || level > 1 || math.IsNaN(level) {
+				return fmt.Errorf("has curveTable entry %d (%v) outside 0-1", i, level)
+			}
+			if i > 0 && level < c.table[i-1] {
+				return fmt.Errorf("has a decreasing curveTable at entry %d: levels must never go down", i)
+			}
+		}
+	default:
+		return fmt.Errorf("has invalid curve %q: must be one of linear, square, inverse-square, gamma, s-curve or table", c.kind)
+	}
+	if c.kind != CurveTable && len(c.table) > 0 {
+		return fmt.Errorf("has a curveTable but curve is %q: set curve to table to use it", c.kind)
+	}
+	return nil
+}
+
+// apply maps a normalized level through the curve. Levels outside 0-1 are clamped first
+// for every curve but linear, since the curves are only defined on that range.
+func (c dimmerCurve) apply(x float64) float64 {
+	if c.kind == CurveLinear {
+		return x
+	}
+	x = math.Max(0, math.Min(1, x))
+
+	switch c.kind {
+	case CurveSquare:
+		return x * x
+	case CurveInverseSquare:
+		return math.Sqrt(x)
+	case CurveGamma:
+		return math.Pow(x, c.gamma)
+	case CurveSCurve:
+		return x * x * (3 - 2*x)
+	case CurveTable:
+		pos := x * float64(len(c.table)-1)
+		i := int(pos)
+		if i >= len(c.table)-1 {
+			return c.table[len(c.table)-1]
+		}
+		frac := pos - float64(i)
+		return c.table[i] + frac*(c.table[i+1]-c.table[i])
+	}
+	return x
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDimmerCurves(t *testing.T) {
+	curves := map[string]ChannelMapping{
+		"linear":         {},
+		"square":         {Curve: CurveSquare},
+		"inverse-square": {Curve: CurveInverseSquare},
+		"gamma default":  {Curve: CurveGamma},
+		"gamma 0.5":      {Curve: CurveGamma, Gamma: 0.5},
+		"gamma 3":        {Curve: CurveGamma, Gamma: 3},
+		"s-curve":        {Curve: CurveSCurve},
+		"table":          {Curve: CurveTable, CurveTable: []float64{0, 0.05, 0.2, 0.2, 0.5, 1}},
+	}
+
+	for name, mapping := range curves {
+		t.Run(name, func(t *testing.T) {
+			curve := mapping.curve()
+			if err := curve.validate(); err != nil {
+				t.Fatalf("validate() unexpected error: %v", err)
+			}
+
+			// Endpoints are preserved, so full off and full on are unaffected by the curve
+			if got := curve.apply(0); got != 0 {
+				t.Errorf("apply(0) = %v, want 0", got)
+			}
+			if got := curve.apply(1); got != 1 {
+				t.Errorf("apply(1) = %v, want 1", got)
+			}
+
+			// Raising the input never lowers the output
+			const steps = 1000
+			previous := curve.apply(0)
+			for i := 1; i <= steps; i++ {
+				x := float64(i) / steps
+				got := curve.apply(x)
+				if got < previous {
+					t.Fatalf("Not monotonic: apply(%v) = %v is below apply(%v) = %v", x, got, float64(i-1)/steps, previous)
+				}
+				if got < 0 || got > 1 {
+					t.Fatalf("apply(%v) = %v is outside 0-1", x, got)
+				}
+				previous = got
+			}
+		})
+	}
+}
+
+func TestDimmerCurveValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		mapping  ChannelMapping
+		input    float64
+		expected float64
+	}{
+		{name: "Square", mapping: ChannelMapping{Curve: CurveSquare}, input: 0.5, expected: 0.25},
+		{name: "Inverse square", mapping: ChannelMapping{Curve: CurveInverseSquare}, input: 0.25, expected: 0.5},
+		{name: "Gamma", mapping: ChannelMapping{Curve: CurveGamma, Gamma: 3}, input: 0.5, expected: 0.125},
+		{name: "S-curve midpoint", mapping: ChannelMapping{Curve: CurveSCurve}, input: 0.5, expected: 0.5},
+		{name: "S-curve low end", mapping: ChannelMapping{Curve: CurveSCurve}, input: 0.25, expected: 0.15625},
+		{name: "Table point", mapping: ChannelMapping{Curve: CurveTable, CurveTable: []float64{0, 0.1, 1}}, input: 0.5, expected: 0.1},
+		{name: "Table interpolated", mapping: ChannelMapping{Curve: CurveTable, CurveTable: []float64{0, 0.1, 1}}, input: 0.75, expected: 0.55},
+		{name: "Input above range is clamped", mapping: ChannelMapping{Curve: CurveSquare}, input: 1.5, expected: 1},
+		{name: "Input below range is clamped", mapping: ChannelMapping{Curve: CurveInverseSquare}, input: -0.5, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.mapping.curve().apply(tt.input); math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("apply(%v) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDimmerCurveScaling(t *testing.T) {
+	// The curve is applied between the input and output ranges
+	scale := ChannelMapping{Curve: CurveSquare, OutputMax: floatPtr(255), Rounding: RoundingNearest}.scaling()
+	if got := scale.apply(50); got != 64 {
+		t.Errorf("apply(50) got = %v, want 64", got)
+	}
+}
+
+func TestDimmerCurveValidation(t *testing.T) {
+	for name, mapping := range map[string]ChannelMapping{
+		"Unknown curve":            {Curve: "cubic"},
+		"Negative gamma":           {Curve: CurveGamma, Gamma: -1},
+		"Table too short":          {Curve: CurveTable, CurveTable: []float64{1}},
+		"Table missing":            {Curve: CurveTable},
+		"Table out of range":       {Curve: CurveTable, CurveTable: []float64{0, 1.5}},
+		"Table decreasing":         {Curve: CurveTable, CurveTable: []float64{0, 0.6, 0.4, 1}},
+		"Table without curve type": {CurveTable: []float64{0, 1}},
+	} {
+		if err := mapping.scaling().validate(); err == nil {
+			t.Errorf("%s: validate() expected an error, but got nil", name)
+		}
+	}
+}
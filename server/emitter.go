@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Fixture color models for ChannelMapping.ColorModel, naming the emitters a fixture has
+const (
+	ColorModelRGB     = "rgb"
+	ColorModelRGBW    = "rgbw"
+	ColorModelRGBA    = "rgba"
+	ColorModelRGBWA   = "rgbwa"
+	ColorModelRGBWAUV = "rgbwauv"
+)
+
+// Emitter names, as used for ChannelMapping.EmitterTopics
+const (
+	EmitterRed   = "red"
+	EmitterGreen = "green"
+	EmitterBlue  = "blue"
+	EmitterWhite = "white"
+	EmitterAmber = "amber"
+	EmitterUV    = "uv"
+)
+
+// colorModelEmitters lists each model's emitters, in the order they are published
+var colorModelEmitters = map[string][]string{
+	ColorModelRGB:     {EmitterRed, EmitterGreen, EmitterBlue},
+	ColorModelRGBW:    {EmitterRed, EmitterGreen, EmitterBlue, EmitterWhite},
+	ColorModelRGBA:    {EmitterRed, EmitterGreen, EmitterBlue, EmitterAmber},
+	ColorModelRGBWA:   {EmitterRed, EmitterGreen, EmitterBlue, EmitterWhite, EmitterAmber},
+	ColorModelRGBWAUV: {EmitterRed, EmitterGreen, EmitterBlue, EmitterWhite, EmitterAmber, EmitterUV},
+}
+
+// White extraction methods for ChannelMapping.WhiteExtraction
+const (
+	WhiteExtractionMin        = "min"        // The common part of red, green and blue moves to the white emitter
+	WhiteExtractionCalibrated = "calibrated" // As min, but relative to the measured color of the white emitter
+	WhiteExtractionNone       = "none"       // The white emitter stays off
+)
+
+// Colors the extra emitters are treated as producing, unless configured otherwise
+var (
+	defaultAmberPoint = RGB{R: 255, G: 191, B: 0}
+	defaultUVPoint    = RGB{R: 128, G: 0, B: 255}
+)
+
+// EmitterLevels are the 0-255 output levels of a fixture's emitters
+type EmitterLevels struct {
+	Red, Green, Blue, White, Amber, UV uint8
+}
+
+// level returns the level of the named emitter
+func (l EmitterLevels) level(emitter string) uint8 {
+	switch emitter {
+	case EmitterRed:
+		return l.Red
+	case EmitterGreen:
+		return l.Green
+	case EmitterBlue:
+		return l.Blue
+	case EmitterWhite:
+		return l.White
+	case EmitterAmber:
+		return l.Amber
+	case EmitterUV:
+		return l.UV
+	}
+	return 0
+}
+
+// emitterField is the PayloadData.Emitters field holding each emitter's level
+var emitterField = map[string]string{
+	EmitterRed:   "Red",
+	EmitterGreen: "Green",
+	EmitterBlue:  "Blue",
+	EmitterWhite: "White",
+	EmitterAmber: "Amber",
+	EmitterUV:    "UV",
+}
+
+// colorDecomposition splits an RGB color into the levels of a fixture's emitters
+type colorDecomposition struct {
+	model    string
+	emitters []string
+	white    *RGB // Color of the white emitter; nil if white is not extracted
+	amber    RGB
+	uv       RGB
+}
+
+// decomposition resolves and validates the mapping's color model settings
+func (cm ChannelMapping) decomposition() (colorDecomposition, error) {
+	d := colorDecomposition{model: cm.ColorModel, amber: defaultAmberPoint, uv: defaultUVPoint}
+	if d.model == "" {
+		d.model = ColorModelRGB
+	}
+	emitters, ok := colorModelEmitters[d.model]
+	if !ok {
+		return d, fmt.Errorf("has invalid colorModel %q: must be one of rgb, rgbw, rgba, rgbwa or rgbwauv", cm.ColorModel)
+	}
+	d.emitters = emitters
+
+	switch cm.WhiteExtraction {
+	case "", WhiteExtractionMin:
+		if cm.WhitePoint != "" {
+			return d, fmt.Errorf("has a whitePoint but whiteExtraction is not calibrated")
+		}
+		d.white = &RGB{R: 255, G: 255, B: 255}
+	case WhiteExtractionCalibrated:
+		if cm.WhitePoint == "" {
+			return d, fmt.Errorf("must set whitePoint for calibrated whiteExtraction")
+		}
+		white, err := parseEmitterPoint("whitePoint", cm.WhitePoint)
+		if err != nil {
+			return d, err
+		}
+		d.white = &white
+	case WhiteExtractionNone:
+	default:
+		return d, fmt.Errorf("has invalid whiteExtraction %q: must be one of min, calibrated or none", cm.WhiteExtraction)
+	}
+
+	if cm.AmberPoint != "" {
+		amber, err := parseEmitterPoint("amberPoint", cm.AmberPoint)
+		if err != nil {
+			return d, err
+		}
+		d.amber = amber
+	}
+	if cm.UVPoint != "" {
+		uv, err := parseEmitterPoint("uvPoint", cm.UVPoint)
+		if err != nil {
+			return d, err
+		}
+		d.uv = uv
+	}
+
+	for emitter := range cm.EmitterTopics {
+		if !d.has(emitter) {
+			return d, fmt.Errorf("has an emitterTopics entry for %q, which is not an emitter of colorModel %s (%s)", emitter, d.model, strings.Join(d.emitters, ", "))
+		}
+	}
+	return d, nil
+}
+
+// parseEmitterPoint parses the color an emitter produces, which must not be black
+func parseEmitterPoint(name, value string) (RGB, error) {
+	c, err := parseHexColor(value)
+	if err != nil {
+		return RGB{}, fmt.Errorf("has invalid %s: %w", name, err)
+	}
+	if c == (RGB{}) {
+		return RGB{}, fmt.Errorf("has invalid %s %q: an emitter can't be black", name, value)
+	}
+	return c, nil
+}
+
+// has reports whether the model includes the named emitter
+func (d colorDecomposition) has(emitter string) bool {
+	for _, e := range d.emitters {
+		if e == emitter {
+			return true
+		}
+	}
+	return false
+}
+
+// decompose computes the emitter levels for a color at the given intensity level (0-1).
+// White, amber and UV are extracted in that order: each takes as much of the remaining
+// color as it can reproduce on its own, which is then removed from the red, green and
+// blue emitters. Models without an emitter skip its extraction.
+func (d colorDecomposition) decompose(c RGB, level float64) EmitterLevels {
+	rgb := [3]float64{float64(c.R) / 255, float64(c.G) / 255, float64(c.B) / 255}
+
+	extract := func(point RGB) float64 {
+		p := [3]float64{float64(point.R) / 255, float64(point.G) / 255, float64(point.B) / 255}
+		amount := 1.0
+		for i := range rgb {
+			if p[i] > 0 {
+				amount = math.Min(amount, rgb[i]/p[i])
+			}
+		}
+		for i := range rgb {
+			rgb[i] = math.Max(0, rgb[i]-amount*p[i])
+		}
+		return amount
+	}
+
+	var white, amber, uv float64
+	if d.has(EmitterWhite) && d.white != nil {
+		white = extract(*d.white)
+	}
+	if d.has(EmitterAmber) {
+		amber = extract(d.amber)
+	}
+	if d.has(EmitterUV) {
+		uv = extract(d.uv)
+	}
+
+	toLevel := func(f float64) uint8 { return uint8(math.Round(f * level * 255)) }
+	return EmitterLevels{
+		Red:   toLevel(rgb[0]),
+		Green: toLevel(rgb[1]),
+		Blue:  toLevel(rgb[2]),
+		White: toLevel(white),
+		Amber: toLevel(amber),
+		UV:    toLevel(uv),
+	}
+}
+
+// format renders the levels of the model's emitters in order, as "255,0,0,128" or as a
+// JSON object like {"red":255,"green":0,"blue":0,"white":128}
+func (d colorDecomposition) format(levels EmitterLevels, asJSON bool) string {
+	parts := make([]string, len(d.emitters))
+	for i, emitter := range d.emitters {
+		if asJSON {
+			parts[i] = fmt.Sprintf("%q:%d", emitter, levels.level(emitter))
+		} else {
+			parts[i] = fmt.Sprintf("%d", levels.level(emitter))
+		}
+	}
+	if asJSON {
+		return "{" + strings.Join(parts, ",") + "}"
+	}
+	return strings.Join(parts, ",")
+}
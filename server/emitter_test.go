@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestColorDecomposition(t *testing.T) {
+	tests := []struct {
+		name     string
+		mapping  ChannelMapping
+		color    RGB
+		level    float64
+		expected EmitterLevels
+	}{
+		{name: "RGB passes through", mapping: ChannelMapping{}, color: RGB{R: 255, G: 128, B: 64}, level: 1,
+			expected: EmitterLevels{Red: 255, Green: 128, Blue: 64}},
+		{name: "RGB dimmed by intensity", mapping: ChannelMapping{}, color: RGB{R: 255, G: 128}, level: 0.5,
+			expected: EmitterLevels{Red: 128, Green: 64}},
+		{name: "RGBW white moves to the white emitter", mapping: ChannelMapping{ColorModel: ColorModelRGBW}, color: RGB{R: 255, G: 255, B: 255}, level: 1,
+			expected: EmitterLevels{White: 255}},
+		{name: "RGBW min channel", mapping: ChannelMapping{ColorModel: ColorModelRGBW}, color: RGB{R: 255, G: 128, B: 128}, level: 1,
+			expected: EmitterLevels{Red: 127, White: 128}},
+		{name: "RGBW saturated color has no white", mapping: ChannelMapping{ColorModel: ColorModelRGBW}, color: RGB{R: 255, G: 128}, level: 1,
+			expected: EmitterLevels{Red: 255, Green: 128}},
+		{name: "RGBW without white extraction", mapping: ChannelMapping{ColorModel: ColorModelRGBW, WhiteExtraction: WhiteExtractionNone}, color: RGB{R: 255, G: 255, B: 255}, level: 1,
+			expected: EmitterLevels{Red: 255, Green: 255, Blue: 255}},
+		{name: "RGBW calibrated warm white", mapping: ChannelMapping{ColorModel: ColorModelRGBW, WhiteExtraction: WhiteExtractionCalibrated, WhitePoint: "#FFE0C0"}, color: RGB{R: 255, G: 255, B: 255}, level: 1,
+			expected: EmitterLevels{Green: 31, Blue: 63, White: 255}},
+		{name: "RGBW calibrated, limited by red", mapping: ChannelMapping{ColorModel: ColorModelRGBW, WhiteExtraction: WhiteExtractionCalibrated, WhitePoint: "#FFE0C0"}, color: RGB{R: 128, G: 255, B: 255}, level: 1,
+			expected: EmitterLevels{Green: 143, Blue: 159, White: 128}},
+		{name: "RGBA amber", mapping: ChannelMapping{ColorModel: ColorModelRGBA}, color: RGB{R: 255, G: 191}, level: 1,
+			expected: EmitterLevels{Amber: 255}},
+		{name: "RGBA custom amber point", mapping: ChannelMapping{ColorModel: ColorModelRGBA, AmberPoint: "#FF8000"}, color: RGB{R: 255, G: 191}, level: 1,
+			expected: EmitterLevels{Green: 63, Amber: 255}},
+		{name: "RGBWA white before amber", mapping: ChannelMapping{ColorModel: ColorModelRGBWA}, color: RGB{R: 255, G: 255, B: 128}, level: 1,
+			expected: EmitterLevels{Green: 32, White: 128, Amber: 127}},
+		{name: "RGBWAUV violet", mapping: ChannelMapping{ColorModel: ColorModelRGBWAUV}, color: RGB{R: 128, B: 255}, level: 1,
+			expected: EmitterLevels{UV: 255}},
+		{name: "RGBWAUV off", mapping: ChannelMapping{ColorModel: ColorModelRGBWAUV}, color: RGB{R: 255, G: 255, B: 255}, level: 0,
+			expected: EmitterLevels{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := tt.mapping.decomposition()
+			if err != nil {
+				t.Fatalf("decomposition() unexpected error: %v", err)
+			}
+			if got := d.decompose(tt.color, tt.level); got != tt.expected {
+				t.Errorf("decompose(%+v, %v) got = %+v, want %+v", tt.color, tt.level, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestColorDecompositionValidation(t *testing.T) {
+	for name, mapping := range map[string]ChannelMapping{
+		"Unknown color model":              {ColorModel: "cmy"},
+		"Unknown white extraction":         {ColorModel: ColorModelRGBW, WhiteExtraction: "average"},
+		"Calibrated without white point":   {ColorModel: ColorModelRGBW, WhiteExtraction: WhiteExtractionCalibrated},
+		"White point without calibration":  {ColorModel: ColorModelRGBW, WhitePoint: "#FFE0C0"},
+		"Malformed white point":            {ColorModel: ColorModelRGBW, WhiteExtraction: WhiteExtractionCalibrated, WhitePoint: "warm"},
+		"Black amber point":                {ColorModel: ColorModelRGBA, AmberPoint: "#000"},
+		"Emitter topic not in color model": {ColorModel: ColorModelRGBW, EmitterTopics: map[string]string{EmitterAmber: "ch1/amber"}},
+		"Unknown emitter topic":            {EmitterTopics: map[string]string{"cyan": "ch1/cyan"}},
+	} {
+		if _, err := mapping.decomposition(); err == nil {
+			t.Errorf("%s: decomposition() expected an error, but got nil", name)
+		}
+	}
+}
+
+func TestEmitterPublish(t *testing.T) {
+	cfg := &Config{
+		ChannelMappings: []ChannelMapping{
+			{ChannelNumber: 1, IntensityTopic: "ch1/intensity", ColorTopic: "ch1/color", OnOffTopic: "ch1/onoff",
+				ColorModel: ColorModelRGBW, ColorFormat: ColorFormatJSONEmitters,
+				EmitterTopics: map[string]string{EmitterRed: "ch1/red", EmitterWhite: "ch1/white"}},
+			{ChannelNumber: 2, IntensityTopic: "ch2/intensity", ColorTopic: "ch2/color", OnOffTopic: "ch2/onoff",
+				ColorModel: ColorModelRGBWA, ColorFormat: ColorFormatEmitters},
+		},
+	}
+	mockMQTT := &MockMQTTClient{}
+	httpServer := NewHTTPServer(cfg, mockMQTT)
+
+	httpServer.processDataPoints([]IncomingDataPoint{
+		{ChannelNumber: 1, Value: json.Number("50"), Color: "#FF8080"},
+		{ChannelNumber: 2, Value: json.Number("100"), Color: "#FFBF00"},
+	}, "test")
+
+	for topic, want := range map[string]string{
+		"ch1/color": `{"red":64,"green":0,"blue":0,"white":64}`,
+		"ch1/red":   "64",
+		"ch1/white": "64",
+		"ch2/color": "0,0,0,0,255",
+	} {
+		if !containsMessage(mockMQTT.PublishedMessages[topic], want) {
+			t.Errorf("Expected %q on %s, got %v", want, topic, mockMQTT.PublishedMessages[topic])
+		}
+	}
+	if _, ok := mockMQTT.PublishedMessages["ch1/green"]; ok {
+		t.Error("Expected no message for an emitter without a topic")
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix starts the name of every environment variable overriding a Config field,
+// e.g. LIGHTBOARD_MQTT_PASSWORD for mqttPassword
+const envPrefix = "LIGHTBOARD_"
+
+// secretFileSuffix marks a variable naming a file to read the value from instead, as
+// with Docker and Kubernetes secrets, e.g. LIGHTBOARD_MQTT_PASSWORD_FILE
+const secretFileSuffix = "_FILE"
+
+// envReferencePattern matches ${VAR} and ${VAR:-default} in configuration values. A
+// reference written as $${VAR} is kept literally, minus the first $.
+var envReferencePattern = regexp.MustCompile(`\$(\$?)\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// lookupSetting reads the variable name, or else the file named by name_FILE. Setting
+// both is an error, since it's unclear which one was meant to win.
+func lookupSetting(lookupEnv func(string) (string, bool), name string) (string, bool, error) {
+	value, ok := lookupEnv(name)
+	file, fileOK := lookupEnv(name + secretFileSuffix)
+	switch {
+	case ok && fileOK:
+		return "", false, fmt.Errorf("both %s and %s%s are set", name, name, secretFileSuffix)
+	case fileOK:
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to read %s%s: %w", name, secretFileSuffix, err)
+		}
+		// Secret files usually end with a newline that isn't part of the secret
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	}
+	return value, ok, nil
+}
+
+// expandEnvReferences replaces ${VAR} references in the values of a YAML document with
+// the environment variables' values (or their _FILE contents). Values are substituted
+// after parsing, so a secret containing YAML syntax like ": " or "#" stays intact, and
+// references in comments and keys are left alone. If nothing was substituted, data is
+// returned as is. Otherwise the document is encoded again, which moves lines around, so
+// lines maps each line of the result to the line of data it came from. If data isn't
+// valid YAML, no data is returned.
+func expandEnvReferences(data []byte, lookupEnv func(string) (string, bool)) ([]byte, map[int]int, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, nil, err
+	}
+
+	var errs []error
+	changed := false
+	var expand func(node *yaml.Node)
+	expand = func(node *yaml.Node) {
+		switch node.Kind {
+		case yaml.ScalarNode:
+			expanded := envReferencePattern.ReplaceAllStringFunc(node.Value, func(reference string) string {
+				match := envReferencePattern.FindStringSubmatch(reference)
+				if match[1] != "" {
+					return reference[1:]
+				}
+				value, ok, err := lookupSetting(lookupEnv, match[2])
+				switch {
+				case err != nil:
+					errs = append(errs, fmt.Errorf("line %d: %w", node.Line, err))
+				case !ok && strings.Contains(reference, ":-"):
+					return match[3]
+				case !ok:
+					errs = append(errs, fmt.Errorf("line %d: environment variable %s is not set", node.Line, match[2]))
+				}
+				return value
+			})
+			if expanded != node.Value {
+				node.Value = expanded
+				if node.Style == 0 {
+					// Resolve unquoted values again, so ${PORT} can fill in a number or
+					// ${RETAIN} a bool. Anything else stays a string: a password of "null"
+					// or "~" must not turn into an empty one.
+					node.Tag = ""
+					switch node.ShortTag() {
+					case "!!int", "!!float", "!!bool":
+					default:
+						node.Tag = "!!str"
+					}
+				}
+				changed = true
+			}
+		case yaml.MappingNode:
+			for i := 1; i < len(node.Content); i += 2 { // Values only; keys are never expanded
+				expand(node.Content[i])
+			}
+		default:
+			for _, child := range node.Content {
+				expand(child)
+			}
+		}
+	}
+	expand(&document)
+	if !changed {
+		return data, nil, errors.Join(errs...) // Keep the file as is, so decoding errors point at the right lines
+	}
+
+	expanded, err := yaml.Marshal(&document)
+	if err != nil {
+		return nil, nil, err
+	}
+	var encoded yaml.Node
+	if err := yaml.Unmarshal(expanded, &encoded); err != nil {
+		return nil, nil, err
+	}
+	lines := make(map[int]int)
+	matchLines(&encoded, &document, lines)
+	return expanded, lines, errors.Join(errs...)
+}
+
+// matchLines records the line of every node in original as the source of the line of
+// the same node in encoded, a copy of original encoded again
+func matchLines(encoded, original *yaml.Node, lines map[int]int) {
+	if _, ok := lines[encoded.Line]; !ok {
+		lines[encoded.Line] = original.Line
+	}
+	for i := 0; i < len(encoded.Content) && i < len(original.Content); i++ {
+		matchLines(encoded.Content[i], original.Content[i], lines)
+	}
+}
+
+// linePrefixPattern matches the position YAML decoding errors start with
+var linePrefixPattern = regexp.MustCompile(`^line (\d+):`)
+
+// sourceLine rewrites the line a decoding error refers to with lines, as returned by
+// expandEnvReferences, so it points at the configuration file
+func sourceLine(problem string, lines map[int]int) string {
+	return linePrefixPattern.ReplaceAllStringFunc(problem, func(prefix string) string {
+		line, _ := strconv.Atoi(linePrefixPattern.FindStringSubmatch(prefix)[1])
+		if source, ok := lines[line]; ok {
+			line = source
+		}
+		return fmt.Sprintf("line %d:", line)
+	})
+}
+
+// envName converts a setting's path, like mqttTls.caFile, to the name of the environment
+// variable overriding it, like LIGHTBOARD_MQTT_TLS_CA_FILE
+func envName(path string) string {
+	var b strings.Builder
+	b.WriteString(envPrefix)
+	for i, r := range path {
+		switch {
+		case r == '.':
+			b.WriteRune('_')
+		case unicode.IsUpper(r) && i > 0 && path[i-1] != '.':
+			b.WriteRune('_')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+// applyEnvOverrides sets every Config field with a LIGHTBOARD_* environment variable
+// (or LIGHTBOARD_*_FILE secret file) to the variable's value
+func applyEnvOverrides(config *Config, lookupEnv func(string) (string, bool)) error {
+	_, err := applyOverrides(reflect.ValueOf(config).Elem(), "", func(path string) (string, bool, error) {
+		return lookupSetting(lookupEnv, envName(path))
+	})
+	return err
+}
+
+// applySetOverrides sets Config fields from "path=value" settings, as given with -set,
+// e.g. "mqttBroker=tcp://broker:1883" or "mqttTls.caFile=/etc/ca.pem"
+func applySetOverrides(config *Config, settings []string) error {
+	values := make(map[string]string, len(settings))
+	var errs []error
+	for _, setting := range settings {
+		path, value, ok := strings.Cut(setting, "=")
+		if !ok {
+			errs = append(errs, fmt.Errorf("-set %q must have the form setting=value", setting))
+			continue
+		}
+		values[path] = value
+	}
+
+	used := make(map[string]bool, len(values))
+	_, err := applyOverrides(reflect.ValueOf(config).Elem(), "", func(path string) (string, bool, error) {
+		value, ok := values[path]
+		used[path] = ok
+		return value, ok, nil
+	})
+	errs = append(errs, err)
+	for _, path := range sortedKeys(values) {
+		if !used[path] {
+			errs = append(errs, fmt.Errorf("-set %s: unknown setting", path))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyOverrides walks the fields of the struct v by their yaml names, setting each one
+// value returns an override for. Nested settings like mqttTls are only created if one of
+// their fields is overridden. It reports whether any field was set.
+func applyOverrides(v reflect.Value, prefix string, value func(path string) (string, bool, error)) (bool, error) {
+	var errs []error
+	set := false
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+		field := v.Field(i)
+
+		if field.Kind() == reflect.Pointer && field.Type().Elem().Kind() == reflect.Struct {
+			nested := reflect.New(field.Type().Elem())
+			if !field.IsNil() {
+				nested.Elem().Set(field.Elem()) // Override a copy, leaving the original untouched on errors
+			}
+			nestedSet, err := applyOverrides(nested.Elem(), path+".", value)
+			errs = append(errs, err)
+			if nestedSet && err == nil {
+				field.Set(nested)
+				set = true
+			}
+			continue
+		}
+		text, ok, err := value(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := setField(field, text); err != nil {
+			errs = append(errs, fmt.Errorf("invalid override for %s: %w", path, err))
+			continue
+		}
+		set = true
+	}
+	return set, errors.Join(errs...)
+}
+
+// setField parses text into a field of one of the kinds used in Config. Lists of strings
+// are comma-separated; other lists, like channelMappings, are given in YAML or JSON.
+func setField(field reflect.Value, text string) error {
+	if field.Kind() == reflect.Pointer {
+		value := reflect.New(field.Type().Elem())
+		if err := setField(value.Elem(), text); err != nil {
+			return err
+		}
+		field.Set(value)
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", text)
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", text)
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", text)
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			items := reflect.New(field.Type())
+			decoder := yaml.NewDecoder(strings.NewReader(text))
+			decoder.KnownFields(true)
+			if err := decoder.Decode(items.Interface()); err != nil && !errors.Is(err, io.EOF) {
+				return fmt.Errorf("not a valid YAML or JSON list: %w", err)
+			}
+			field.Set(items.Elem())
+			return nil
+		}
+		var items []string
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("settings of type %s can't be overridden", field.Type())
+	}
+	return nil
+}
+
+// settingsFlag collects the values of a repeatable flag, like -set
+type settingsFlag []string
+
+func (f *settingsFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *settingsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"mqttBroker":           "LIGHTBOARD_MQTT_BROKER",
+		"mqttPassword":         "LIGHTBOARD_MQTT_PASSWORD",
+		"httpListenAddr":       "LIGHTBOARD_HTTP_LISTEN_ADDR",
+		"qos":                  "LIGHTBOARD_QOS",
+		"mqttPublishTimeoutMs": "LIGHTBOARD_MQTT_PUBLISH_TIMEOUT_MS",
+		"mqttTls.caFile":       "LIGHTBOARD_MQTT_TLS_CA_FILE",
+		"mqttWill.topic":       "LIGHTBOARD_MQTT_WILL_TOPIC",
+	}
+	for path, expected := range tests {
+		if got := envName(path); got != expected {
+			t.Errorf("envName(%q) = %q, want %q", path, got, expected)
+		}
+	}
+}
+
+func TestLoadConfigWithEnvironment(t *testing.T) {
+	tempDir := t.TempDir()
+	secretPath := filepath.Join(tempDir, "mqtt_password")
+	if err := os.WriteFile(secretPath, []byte("from-secret-file\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+
+	baseConfig := `
+mqttBroker: "tcp://localhost:1883"
+mqttPassword: "from-yaml"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]
+`
+
+	tests := []struct {
+		name      string
+		config    string
+		env       map[string]string
+		overrides []string
+		errorMsg  string // Expected error substring; empty if no error is expected
+		check     func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "References are expanded",
+			config: `
+mqttBroker: "${BROKER_URL}"
+mqttPassword: ${MQTT_SECRET}
+mqttKeepAliveSeconds: ${KEEP_ALIVE}
+channelMappings: [{channelNumber: 1, intensityTopic: "${SITE}/i", colorTopic: "c", onOffTopic: "o"}]`,
+			env: map[string]string{"BROKER_URL": "tcp://broker:1883", "MQTT_SECRET": "p: w #1", "KEEP_ALIVE": "30", "SITE": "stage"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.MQTTBroker != "tcp://broker:1883" || cfg.MQTTPassword != "p: w #1" || cfg.MQTTKeepAliveSeconds != 30 {
+					t.Errorf("Expected expanded broker, password and keep alive, got %q, %q, %d", cfg.MQTTBroker, cfg.MQTTPassword, cfg.MQTTKeepAliveSeconds)
+				}
+				if cfg.ChannelMappings[0].IntensityTopic != "stage/i" {
+					t.Errorf("Expected expanded topic, got %q", cfg.ChannelMappings[0].IntensityTopic)
+				}
+			},
+		},
+		{
+			name: "References to null values stay strings",
+			config: `
+mqttBroker: "tcp://localhost:1883"
+mqttUsername: ${MQTT_USER}
+mqttPassword: ${MQTT_SECRET}
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`,
+			env: map[string]string{"MQTT_USER": "null", "MQTT_SECRET": "~"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.MQTTUsername != "null" || cfg.MQTTPassword != "~" {
+					t.Errorf("Expected the username %q and password %q, got %q and %q", "null", "~", cfg.MQTTUsername, cfg.MQTTPassword)
+				}
+			},
+		},
+		{
+			name: "Reference defaults and escapes",
+			config: `
+mqttBroker: "${BROKER_URL:-tcp://fallback:1883}"
+mqttPassword: "$${NOT_EXPANDED}"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`,
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.MQTTBroker != "tcp://fallback:1883" {
+					t.Errorf("Expected the default broker, got %q", cfg.MQTTBroker)
+				}
+				if cfg.MQTTPassword != "${NOT_EXPANDED}" {
+					t.Errorf("Expected the escaped reference to stay, got %q", cfg.MQTTPassword)
+				}
+			},
+		},
+		{
+			name: "Reference read from a secret file",
+			config: `
+mqttBroker: "tcp://localhost:1883"
+mqttPassword: "${MQTT_SECRET}"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`,
+			env: map[string]string{"MQTT_SECRET_FILE": secretPath},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.MQTTPassword != "from-secret-file" {
+					t.Errorf("Expected the password from the secret file, got %q", cfg.MQTTPassword)
+				}
+			},
+		},
+		{
+			name: "Unset reference",
+			config: `
+mqttBroker: "tcp://localhost:1883"
+mqttPassword: "${MQTT_SECRET}"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`,
+			errorMsg: "line 3: environment variable MQTT_SECRET is not set",
+		},
+		{
+			name: "References in comments are left alone",
+			config: `
+# Set the password with "${MQTT_SECRET}"
+
+mqttBroker: "tcp://localhost:1883"
+
+mqttPasword: "typo"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`,
+			errorMsg: "line 6: field mqttPasword not found",
+		},
+		{
+			name: "Errors point at the file after expansion",
+			config: `
+# MQTT settings
+
+mqttBroker: "${BROKER_URL}" # From the environment
+
+
+mqttPasword: "typo"
+channelMappings: [{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`,
+			env:      map[string]string{"BROKER_URL": "tcp://broker:1883"},
+			errorMsg: "line 7: field mqttPasword not found",
+		},
+		{
+			name:   "Environment overrides the file",
+			config: baseConfig,
+			env:    map[string]string{"LIGHTBOARD_MQTT_PASSWORD": "from-env", "LIGHTBOARD_QOS": "1", "LIGHTBOARD_RETAIN": "true", "LIGHTBOARD_FIXTURE_PROFILES": ""},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.MQTTPassword != "from-env" || cfg.QoS != 1 || !cfg.Retain {
+					t.Errorf("Expected password, qos and retain from the environment, got %q, %d, %t", cfg.MQTTPassword, cfg.QoS, cfg.Retain)
+				}
+			},
+		},
+		{
+			name:   "Environment secret file",
+			config: baseConfig,
+			env:    map[string]string{"LIGHTBOARD_MQTT_PASSWORD_FILE": secretPath},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.MQTTPassword != "from-secret-file" {
+					t.Errorf("Expected the password from the secret file, got %q", cfg.MQTTPassword)
+				}
+			},
+		},
+		{
+			name:   "Environment creates nested settings",
+			config: baseConfig,
+			env:    map[string]string{"LIGHTBOARD_MQTT_WILL_TOPIC": "lightboard/status", "LIGHTBOARD_MQTT_AUTO_RECONNECT": "false"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.MQTTWill == nil || cfg.MQTTWill.Topic != "lightboard/status" || cfg.MQTTWill.Payload != "offline" {
+					t.Errorf("Expected a will on lightboard/status with defaults, got %+v", cfg.MQTTWill)
+				}
+				if *cfg.MQTTAutoReconnect {
+					t.Errorf("Expected mqttAutoReconnect to be disabled")
+				}
+			},
+		},
+		{
+			name:     "Environment value and secret file both set",
+			config:   baseConfig,
+			env:      map[string]string{"LIGHTBOARD_MQTT_PASSWORD": "from-env", "LIGHTBOARD_MQTT_PASSWORD_FILE": secretPath},
+			errorMsg: "both LIGHTBOARD_MQTT_PASSWORD and LIGHTBOARD_MQTT_PASSWORD_FILE are set",
+		},
+		{
+			name:     "Missing environment secret file",
+			config:   baseConfig,
+			env:      map[string]string{"LIGHTBOARD_MQTT_PASSWORD_FILE": filepath.Join(tempDir, "missing")},
+			errorMsg: "failed to read LIGHTBOARD_MQTT_PASSWORD_FILE",
+		},
+		{
+			name:     "Invalid environment value",
+			config:   baseConfig,
+			env:      map[string]string{"LIGHTBOARD_MQTT_KEEP_ALIVE_SECONDS": "a minute"},
+			errorMsg: "invalid override for mqttKeepAliveSeconds",
+		},
+		{
+			name:      "Overrides take precedence over the environment",
+			config:    baseConfig,
+			env:       map[string]string{"LIGHTBOARD_MQTT_PASSWORD": "from-env"},
+			overrides: []string{"mqttPassword=from-flag", "mqttTls.insecureSkipVerify=true", "mqttBroker=ssl://broker:8883"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.MQTTPassword != "from-flag" {
+					t.Errorf("Expected the password from the override, got %q", cfg.MQTTPassword)
+				}
+				if cfg.MQTTTLS == nil || !cfg.MQTTTLS.InsecureSkipVerify {
+					t.Errorf("Expected mqttTls.insecureSkipVerify from the override, got %+v", cfg.MQTTTLS)
+				}
+			},
+		},
+		{
+			name:      "Channel mappings override",
+			config:    baseConfig,
+			env:       map[string]string{"LIGHTBOARD_CHANNEL_MAPPINGS": `[{"channelNumber": 2, "intensityTopic": "env/i", "colorTopic": "env/c", "onOffTopic": "env/o"}]`},
+			overrides: []string{"channelMappings=[{channelNumber: 3, intensityTopic: flag/i, colorTopic: flag/c, onOffTopic: flag/o}]"},
+			check: func(t *testing.T, cfg *Config) {
+				if len(cfg.ChannelMappings) != 1 || cfg.ChannelMappings[0].ChannelNumber != 3 || cfg.ChannelMappings[0].IntensityTopic != "flag/i" {
+					t.Errorf("Expected the channel mappings from the override, got %+v", cfg.ChannelMappings)
+				}
+			},
+		},
+		{
+			name:     "Invalid channel mappings override",
+			config:   baseConfig,
+			env:      map[string]string{"LIGHTBOARD_CHANNEL_MAPPINGS": `[{"channelNumber": 2, "intensityTopik": "env/i"}]`},
+			errorMsg: "invalid override for channelMappings",
+		},
+		{
+			name:      "Unknown override",
+			config:    baseConfig,
+			overrides: []string{"mqttPasword=typo"},
+			errorMsg:  "-set mqttPasword: unknown setting",
+		},
+		{
+			name:      "Malformed override",
+			config:    baseConfig,
+			overrides: []string{"mqttPassword"},
+			errorMsg:  "must have the form setting=value",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			configPath := filepath.Join(tempDir, "config"+strconv.Itoa(i)+".yaml")
+			if err := os.WriteFile(configPath, []byte(tt.config), 0644); err != nil {
+				t.Fatalf("Failed to write config file: %v", err)
+			}
+
+			cfg, err := LoadConfig(configPath, tt.overrides...)
+			if tt.errorMsg != "" {
+				if err == nil {
+					t.Fatalf("LoadConfig() expected an error containing %q, but got nil", tt.errorMsg)
+				}
+				if !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Errorf("LoadConfig() error = %q, want it to contain %q", err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() unexpected error: %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadConfigWithoutFile(t *testing.T) {
+	t.Setenv("LIGHTBOARD_MQTT_BROKER", "tcp://broker:1883")
+	t.Setenv("LIGHTBOARD_CHANNEL_MAPPINGS", `[{channelNumber: 1, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`)
+
+	cfg, err := LoadConfig("", "httpListenAddr=:9090")
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if cfg.MQTTBroker != "tcp://broker:1883" || cfg.HTTPListenAddr != ":9090" || len(cfg.ChannelMappings) != 1 {
+		t.Errorf("Expected the settings from the environment and overrides, got %+v", cfg)
+	}
+
+	t.Setenv("LIGHTBOARD_CHANNEL_MAPPINGS", "")
+	if _, err := LoadConfig(""); err == nil || !strings.Contains(err.Error(), "at least one channelMapping") {
+		t.Errorf("Expected an error without channel mappings, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// sseHeartbeatInterval is how often a comment line is sent on idle /events streams
+// so proxies and browsers don't time out the connection
+var sseHeartbeatInterval = 15 * time.Second
+
+// handleEventsRequest serves GET /events as a Server-Sent Events stream. The current
+// state of every known channel is sent first, followed by a "state" event for every
+// subsequent change. Each event's data is a JSON-encoded ChannelState, whose source
+// field identifies the client that caused the change.
+func (hs *HTTPServer) handleEventsRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is accepted", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported by this connection", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before taking the snapshot so no change can fall between the two
+	updates, unsubscribe := hs.state.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable response buffering in nginx
+	w.WriteHeader(http.StatusOK)
+
+	for _, state := range hs.state.All() {
+		if err := writeSSEEvent(w, "state", state); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	log.Printf("Event stream client connected from %s", r.RemoteAddr)
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Printf("Event stream client %s disconnected", r.RemoteAddr)
+			return
+		case <-hs.shutdown:
+			return
+		case state, ok := <-updates:
+			if !ok {
+				// Dropped for falling behind; the client is expected to reconnect
+				return
+			}
+			if err := writeSSEEvent(w, "state", state); err != nil {
+				log.Printf("Error writing event to %s: %v", r.RemoteAddr, err)
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeSSEEvent writes a single named Server-Sent Event with a JSON data payload
+func writeSSEEvent(w http.ResponseWriter, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
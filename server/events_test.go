@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleEventsRequest(t *testing.T) {
+	originalInterval := sseHeartbeatInterval
+	sseHeartbeatInterval = 50 * time.Millisecond
+	defer func() { sseHeartbeatInterval = originalInterval }()
+
+	cfg := &Config{
+		HTTPListenAddr: ":8080",
+		ChannelMappings: []ChannelMapping{
+			{ChannelNumber: 1, IntensityTopic: "ch1/intensity", ColorTopic: "ch1/color", OnOffTopic: "ch1/onoff"},
+			{ChannelNumber: 2, IntensityTopic: "ch2/intensity", ColorTopic: "ch2/color", OnOffTopic: "ch2/onoff"},
+		},
+	}
+	httpServer := NewHTTPServer(cfg, &MockMQTTClient{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/post", corsMiddleware(httpServer.handleDataRequest))
+	mux.HandleFunc("/events", corsMiddlewareWithMethods("GET, OPTIONS", httpServer.handleEventsRequest))
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	post := func(body string) {
+		resp, err := http.Post(testServer.URL+"/post", "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Failed to POST: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// State that exists before the client connects is sent as the initial snapshot
+	post(`[{"channelNumber":1,"value":10,"color":"#FF0000"}]`)
+
+	resp, err := http.Get(testServer.URL + "/events")
+	if err != nil {
+		t.Fatalf("Failed to GET /events: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected Content-Type text/event-stream, got %s", ct)
+	}
+
+	events := make(chan ChannelState, 10)
+	heartbeats := make(chan struct{}, 10)
+	streamClosed := make(chan struct{})
+	go func() {
+		defer close(streamClosed)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "data: "):
+				var state ChannelState
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &state); err != nil {
+					t.Errorf("Failed to decode event data %q: %v", line, err)
+					continue
+				}
+				events <- state
+			case strings.HasPrefix(line, ": heartbeat"):
+				select {
+				case heartbeats <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	nextEvent := func() ChannelState {
+		select {
+		case state := <-events:
+			return state
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for event")
+		}
+		return ChannelState{}
+	}
+
+	if state := nextEvent(); state.ChannelNumber != 1 || state.Value != 10 {
+		t.Errorf("Expected snapshot of channel 1, got %+v", state)
+	}
+
+	post(`[{"channelNumber":2,"value":42,"color":"#00FF00"}]`)
+	state := nextEvent()
+	if state.ChannelNumber != 2 || state.Value != 42 || state.Color != "#00FF00" || !state.On {
+		t.Errorf("Unexpected event for channel 2: %+v", state)
+	}
+	if !strings.HasPrefix(state.Source, "post ") {
+		t.Errorf("Expected source to identify the POST client, got %q", state.Source)
+	}
+
+	// Re-sending an unchanged value produces no event; the next change does
+	post(`[{"channelNumber":2,"value":42,"color":"#00FF00"}]`)
+	post(`[{"channelNumber":2,"value":0,"color":"#00FF00"}]`)
+	if state := nextEvent(); state.ChannelNumber != 2 || state.Value != 0 || state.On {
+		t.Errorf("Expected channel 2 to turn off, got %+v", state)
+	}
+
+	select {
+	case <-heartbeats:
+	case <-time.After(2 * time.Second):
+		t.Error("Timed out waiting for heartbeat")
+	}
+
+	// Shutdown must end the stream rather than wait for the client to leave
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+	select {
+	case <-streamClosed:
+	case <-time.After(2 * time.Second):
+		t.Error("Event stream was not closed by Shutdown")
+	}
+}
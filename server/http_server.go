@@ -3,16 +3,28 @@ package main
 import (
 	"context" // Added context
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"mime"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 // MQTTClientInterface defines the methods our HTTP server needs from an MQTT client.
 type MQTTClientInterface interface {
-	Publish(topic string, payload interface{}) error
+	Publish(topic string, qos byte, retained bool, payload interface{}) error
+	ConfirmsDelivery(qos byte) bool // Whether Publish waits for the broker to acknowledge at this QoS
+	Status() MQTTStatus
 	Disconnect()
+	Reconfigure(cfg *Config)             // Adopts the publish settings of a reloaded configuration with unchanged connection settings
+	Retire(next *Config)                 // Disconnects a client replaced by a reload with next
+	TakeQueue() []queuedMessage          // Empties the offline queue, for the client replacing this one
+	AdoptQueue(messages []queuedMessage) // Sends messages queued by the client this one replaces
 }
 
 // HTTPServer wraps the HTTP server logic
@@ -20,42 +32,135 @@ type HTTPServer struct {
 	config         *Config
 	mqttClient     MQTTClientInterface    // Using the interface
 	channelMap     map[int]ChannelMapping // Changed: map channel number to full ChannelMapping
-	channelMapLock sync.RWMutex
+	channelMapLock sync.RWMutex           // Guards config, mqttClient and channelMap, which Reload swaps together
 	serverInstance *http.Server
+	wsConns        map[*websocket.Conn]struct{} // Open /ws connections, closed on shutdown
+	wsConnsLock    sync.Mutex
+	state          *StateStore   // Last accepted state of every channel
+	shutdown       chan struct{} // Closed by Shutdown to end long-lived /events streams
+	shutdownOnce   sync.Once
+	payloads       *payloadTemplateCache // Compiled payload templates
+	configPath     string                // Config file the channel API writes changes back to, if apiWriteConfig is set
+	apiLock        sync.Mutex            // Serializes channel API changes, which write the config file outside channelMapLock
+	apiChannels    map[int]bool          // Channels changed through the API but not in the config file; guarded by channelMapLock
 }
 
-// IncomingDataPoint represents a single data point from the HTTP JSON array
+// IncomingDataPoint represents a single data point from the HTTP JSON array. Every
+// attribute is optional: only the ones present are published, and the others keep the
+// channel's last known state, so a client can change the color without touching the
+// intensity set by another.
 type IncomingDataPoint struct {
 	ChannelNumber int         `json:"channelNumber"` // Changed from ChannelDescription
-	Value         json.Number `json:"value"`
-	Color         string      `json:"color"`
+	Value         json.Number `json:"value,omitempty"`
+	Color         string      `json:"color,omitempty"`
+	On            *bool       `json:"on,omitempty"`     // Explicit on/off state; defaults to value > 0 when a value is sent
+	Kelvin        json.Number `json:"kelvin,omitempty"` // Optional color temperature for tunable-white fixtures
+}
+
+// channelChanges tells which attributes of a channel a data point set, and so which of
+// the channel's topics need publishing
+type channelChanges struct {
+	value, color, on, kelvin bool
 }
 
+// allChannelChanges publishes every topic, e.g. when republishing restored state
+var allChannelChanges = channelChanges{value: true, color: true, on: true, kelvin: true}
+
 // MQTTMessagePayload struct is removed as it's no longer used.
 
+// Delivery statuses reported for each data point
+const (
+	DeliveryConfirmed = "confirmed" // Every publish was acknowledged by the broker
+	DeliverySent      = "sent"      // Every publish was handed to the MQTT client without waiting for acknowledgement
+	DeliveryQueued    = "queued"    // The broker is disconnected; the latest values will be sent on reconnect
+	DeliveryUnchanged = "unchanged" // Valid, but the channel has no topic for what it set; nothing was published
+	DeliveryFailed    = "failed"    // At least one publish failed or was not acknowledged in time
+	DeliveryRejected  = "rejected"  // Invalid data or unknown channel; nothing was published
+)
+
+// Error codes telling clients why a data point, or a whole request, was not delivered
+const (
+	ErrorUnknownChannel = "unknown_channel" // No channelMappings entry for the channelNumber
+	ErrorInvalidValue   = "invalid_value"
+	ErrorInvalidColor   = "invalid_color"
+	ErrorInvalidKelvin  = "invalid_kelvin"
+	ErrorEmptyDataPoint = "empty_data_point" // None of value, color, on or kelvin was sent
+	ErrorPublishFailed  = "publish_failed"   // A payload could not be built or published
+	ErrorInvalidJSON    = "invalid_json"     // The request body is not a JSON array of data points
+	ErrorEmptyRequest   = "empty_request"
+)
+
+// DataPointResult is the outcome of processing a single IncomingDataPoint
+type DataPointResult struct {
+	Index         int      `json:"index"` // Position of the data point in the request array
+	ChannelNumber int      `json:"channelNumber"`
+	Status        string   `json:"status"`
+	Code          string   `json:"code,omitempty"` // Error code if the data point was rejected or failed
+	Errors        []string `json:"errors,omitempty"`
+	Topics        []string `json:"topics,omitempty"` // Topics published or queued, in order
+}
+
+// ResultSummary counts the data points of a request by delivery status
+type ResultSummary struct {
+	Total     int `json:"total"`
+	Processed int `json:"processed"` // Data points that passed validation, whatever their delivery status
+	Confirmed int `json:"confirmed"`
+	Sent      int `json:"sent"`
+	Queued    int `json:"queued"`
+	Unchanged int `json:"unchanged"`
+	Failed    int `json:"failed"`
+	Rejected  int `json:"rejected"`
+}
+
+// PostResponse is the JSON body /post answers with, unless the client asks for text/plain
+type PostResponse struct {
+	Status  string            `json:"status"`            // "ok", or "error" if any data point was rejected or failed
+	Code    string            `json:"code,omitempty"`    // Error code if the whole request was refused
+	Summary ResultSummary     `json:"summary"`           // Counts of the results
+	Errors  []string          `json:"errors,omitempty"`  // Every validation and publish error
+	Results []DataPointResult `json:"results,omitempty"` // Outcome of each data point, in request order
+}
+
 // NewHTTPServer creates a new HTTP server instance
 func NewHTTPServer(cfg *Config, mqttClient MQTTClientInterface) *HTTPServer { // Using the interface
 	hs := &HTTPServer{
 		config:     cfg,
 		mqttClient: mqttClient,
-		channelMap: make(map[int]ChannelMapping), // Initialize new channelMap
+		channelMap: newChannelMap(cfg),
+		wsConns:    make(map[*websocket.Conn]struct{}),
+		state:      NewStateStore(),
+		shutdown:   make(chan struct{}),
+		payloads:   newPayloadTemplateCache(),
 	}
+	return hs
+}
 
-	// Populate the channel map for quick lookups
-	hs.channelMapLock.Lock()
+// newChannelMap indexes the configured mappings by channel number for quick lookups
+func newChannelMap(cfg *Config) map[int]ChannelMapping {
+	channelMap := make(map[int]ChannelMapping, len(cfg.ChannelMappings))
 	for _, mapping := range cfg.ChannelMappings {
-		hs.channelMap[mapping.ChannelNumber] = mapping // Use ChannelNumber as key
+		channelMap[mapping.ChannelNumber] = mapping // Use ChannelNumber as key
 	}
-	hs.channelMapLock.Unlock()
+	return channelMap
+}
 
-	return hs
+// current returns the configuration and MQTT client in use, which Reload may replace
+func (hs *HTTPServer) current() (*Config, MQTTClientInterface) {
+	hs.channelMapLock.RLock()
+	defer hs.channelMapLock.RUnlock()
+	return hs.config, hs.mqttClient
 }
 
 // corsMiddleware adds necessary CORS headers and handles OPTIONS preflight requests
 func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return corsMiddlewareWithMethods("POST, OPTIONS", next)
+}
+
+// corsMiddlewareWithMethods is corsMiddleware for endpoints accepting other methods than POST
+func corsMiddlewareWithMethods(methods string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", methods)
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization") // Common headers
 
 		if r.Method == http.MethodOptions {
@@ -71,20 +176,26 @@ func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 func (hs *HTTPServer) Start() error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/post", corsMiddleware(hs.handleDataRequest)) // Wrap handler with CORS middleware
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		// Health check typically doesn't need CORS for GET requests from browsers,
-		// but if it were accessed via JS from another origin, it might.
-		// For simplicity, not wrapping health check with CORS unless specified.
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintln(w, "OK")
-	})
+	mux.HandleFunc("/ws", hs.handleWebSocket)                     // Streaming alternative to /post
+	mux.HandleFunc("/state", corsMiddlewareWithMethods("GET, OPTIONS", hs.handleStateRequest))
+	mux.HandleFunc("/state/{channelNumber}", corsMiddlewareWithMethods("GET, OPTIONS", hs.handleChannelStateRequest))
+	mux.HandleFunc("/events", corsMiddlewareWithMethods("GET, OPTIONS", hs.handleEventsRequest))
+	mux.HandleFunc("/channels", corsMiddlewareWithMethods("GET, OPTIONS", hs.handleChannelSummaryRequest))
+	mux.HandleFunc("/api/channels", corsMiddlewareWithMethods("GET, OPTIONS", hs.requireAPIToken(hs.handleChannelsRequest)))
+	mux.HandleFunc("/api/channels/{channelNumber}", corsMiddlewareWithMethods("GET, PUT, DELETE, OPTIONS", hs.requireAPIToken(hs.handleChannelRequest)))
+	// Health check typically doesn't need CORS for GET requests from browsers,
+	// but if it were accessed via JS from another origin, it might.
+	// For simplicity, not wrapping health check with CORS unless specified.
+	mux.HandleFunc("/health", hs.handleHealthRequest)
 
+	cfg, _ := hs.current()
 	hs.serverInstance = &http.Server{
-		Addr:    hs.config.HTTPListenAddr,
+		Addr:    cfg.HTTPListenAddr,
 		Handler: mux,
 	}
+	hs.serverInstance.RegisterOnShutdown(hs.closeWebSockets)
 
-	log.Printf("HTTP server listening on %s", hs.config.HTTPListenAddr)
+	log.Printf("HTTP server listening on %s", cfg.HTTPListenAddr)
 	if err := hs.serverInstance.ListenAndServe(); err != http.ErrServerClosed {
 		return fmt.Errorf("http server ListenAndServe error: %w", err)
 	}
@@ -93,6 +204,9 @@ func (hs *HTTPServer) Start() error {
 
 // Shutdown gracefully shuts down the HTTP server
 func (hs *HTTPServer) Shutdown(ctx_ context.Context) error {
+	// Event streams never go idle on their own, so end them before waiting on connections
+	hs.shutdownOnce.Do(func() { close(hs.shutdown) })
+
 	if hs.serverInstance != nil {
 		log.Println("Shutting down HTTP server...")
 		return hs.serverInstance.Shutdown(ctx_)
@@ -100,32 +214,101 @@ func (hs *HTTPServer) Shutdown(ctx_ context.Context) error {
 	return nil
 }
 
+// handleHealthRequest always answers "OK" while the server is up, followed by the MQTT
+// connection state and offline queue depth, so a degraded bridge can be spotted
+func (hs *HTTPServer) handleHealthRequest(w http.ResponseWriter, r *http.Request) {
+	_, mqttClient := hs.current()
+	status := mqttClient.Status()
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "OK")
+	fmt.Fprintf(w, "mqttConnected: %t\n", status.Connected)
+	fmt.Fprintf(w, "queuedMessages: %d\n", status.QueuedMessages)
+	fmt.Fprintf(w, "droppedMessages: %d\n", status.DroppedMessages)
+}
+
 func (hs *HTTPServer) handleDataRequest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Only POST method is accepted", http.StatusMethodNotAllowed)
 		return
 	}
 
+	plainText := prefersPlainText(r)
+
 	var dataPoints []IncomingDataPoint
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&dataPoints); err != nil {
 		log.Printf("Error decoding JSON request: %v", err)
-		http.Error(w, fmt.Sprintf("Invalid JSON payload: %v", err), http.StatusBadRequest)
+		writeRequestError(w, plainText, ErrorInvalidJSON, fmt.Sprintf("Invalid JSON payload: %v", err))
 		return
 	}
 	defer r.Body.Close()
 
 	if len(dataPoints) == 0 {
 		log.Println("Received empty data array")
-		http.Error(w, "Received empty data array", http.StatusBadRequest)
+		writeRequestError(w, plainText, ErrorEmptyRequest, "Received empty data array")
 		return
 	}
 
-	var processingErrors []string
-	var successfulMessages int
-	var publishErrors []string // Keep track of errors during individual MQTT publishes
+	results := hs.processDataPoints(dataPoints, requestSource("post", r))
+	summary, allErrors := summarizeResults(results)
+
+	response := PostResponse{Status: "ok", Summary: summary, Errors: allErrors, Results: results}
+	statusCode := http.StatusOK
+	if len(allErrors) > 0 {
+		log.Printf("%d data points processed. Encountered errors: %v", summary.Processed, allErrors)
+		response.Status, statusCode = "error", http.StatusMultiStatus // 207 Multi-Status
+	}
+
+	switch {
+	case !plainText:
+		writeJSON(w, statusCode, response)
+	case len(allErrors) > 0:
+		http.Error(w, fmt.Sprintf("Completed with errors: %v\n%s", allErrors, formatResults(results)), statusCode)
+	default:
+		w.WriteHeader(statusCode)
+		fmt.Fprintf(w, "Successfully processed %d data points.\n%s", summary.Processed, formatResults(results))
+	}
+}
+
+// writeRequestError refuses a whole /post request with 400 Bad Request
+func writeRequestError(w http.ResponseWriter, plainText bool, code, message string) {
+	if plainText {
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusBadRequest, PostResponse{Status: "error", Code: code, Errors: []string{message}})
+}
+
+// prefersPlainText reports whether the client asked for the plain text /post response
+// that predates the JSON one: it accepts text/plain, but not JSON
+func prefersPlainText(r *http.Request) bool {
+	plainText, jsonAccepted := false, false
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		switch mediaType {
+		case "text/plain":
+			plainText = true
+		case "application/json", "application/*":
+			jsonAccepted = true
+		}
+	}
+	return plainText && !jsonAccepted
+}
+
+// processDataPoints maps each data point to its channel's topics and publishes them.
+// It is shared by the /post and /ws handlers so both follow the same mapping and publish path.
+// Every data point that passes validation is merged into the channel's state in the state
+// store, attributed to source, and only the topics of the attributes it set are published.
+// It returns one result per data point, in request order.
+func (hs *HTTPServer) processDataPoints(dataPoints []IncomingDataPoint, source string) []DataPointResult {
+	results := make([]DataPointResult, 0, len(dataPoints))
+
+	for i, dp := range dataPoints {
+		result := DataPointResult{Index: i, ChannelNumber: dp.ChannelNumber}
 
-	for _, dp := range dataPoints {
 		hs.channelMapLock.RLock()
 		mapping, ok := hs.channelMap[dp.ChannelNumber]
 		hs.channelMapLock.RUnlock()
@@ -133,80 +316,266 @@ func (hs *HTTPServer) handleDataRequest(w http.ResponseWriter, r *http.Request)
 		if !ok {
 			errMsg := fmt.Sprintf("No topic mapping found for channelNumber: %d", dp.ChannelNumber)
 			log.Println(errMsg)
-			processingErrors = append(processingErrors, errMsg) // This is a config/request data error
+			result.Status, result.Code, result.Errors = DeliveryRejected, ErrorUnknownChannel, []string{errMsg} // This is a config/request data error
+			results = append(results, result)
 			continue
 		}
 
-		valueFloat, err := dp.Value.Float64()
-		if err != nil {
-			errMsg := fmt.Sprintf("Invalid value for channelNumber %d: %v", dp.ChannelNumber, err)
+		changes := channelChanges{value: dp.Value != "", color: dp.Color != "", on: dp.On != nil, kelvin: dp.Kelvin != ""}
+		if changes == (channelChanges{}) {
+			errMsg := fmt.Sprintf("Data point for channelNumber %d has none of value, color, on or kelvin", dp.ChannelNumber)
 			log.Println(errMsg)
-			processingErrors = append(processingErrors, errMsg) // This is a data error
+			result.Status, result.Code, result.Errors = DeliveryRejected, ErrorEmptyDataPoint, []string{errMsg} // This is a data error
+			results = append(results, result)
 			continue
 		}
 
-		// 1. Publish Intensity (Value)
-		// Convert float to string for MQTT payload, or send as number if broker/client handles it.
-		// For simplicity, sending as string.
-		intensityPayload := fmt.Sprintf("%f", valueFloat)
-		if err := hs.mqttClient.Publish(mapping.IntensityTopic, intensityPayload); err != nil {
-			errMsg := fmt.Sprintf("Failed to publish intensity to MQTT topic '%s' for channelNumber %d: %v", mapping.IntensityTopic, dp.ChannelNumber, err)
-			log.Println(errMsg)
-			publishErrors = append(publishErrors, errMsg)
-		} else {
-			log.Printf("Published intensity to %s: %s", mapping.IntensityTopic, intensityPayload)
+		var valueFloat float64
+		if changes.value {
+			var err error
+			valueFloat, err = dp.Value.Float64()
+			if err != nil {
+				errMsg := fmt.Sprintf("Invalid value for channelNumber %d: %v", dp.ChannelNumber, err)
+				log.Println(errMsg)
+				result.Status, result.Code, result.Errors = DeliveryRejected, ErrorInvalidValue, []string{errMsg} // This is a data error
+				results = append(results, result)
+				continue
+			}
 		}
 
-		// 2. Publish Color
-		if err := hs.mqttClient.Publish(mapping.ColorTopic, dp.Color); err != nil {
-			errMsg := fmt.Sprintf("Failed to publish color to MQTT topic '%s' for channelNumber %d: %v", mapping.ColorTopic, dp.ChannelNumber, err)
-			log.Println(errMsg)
-			publishErrors = append(publishErrors, errMsg)
-		} else {
-			log.Printf("Published color to %s: %s", mapping.ColorTopic, dp.Color)
+		if changes.color {
+			if _, err := parseHexColor(dp.Color); err != nil {
+				errMsg := fmt.Sprintf("Invalid color for channelNumber %d: %v", dp.ChannelNumber, err)
+				log.Println(errMsg)
+				result.Status, result.Code, result.Errors = DeliveryRejected, ErrorInvalidColor, []string{errMsg} // This is a data error
+				results = append(results, result)
+				continue
+			}
+		}
+
+		var kelvin float64
+		if changes.kelvin {
+			var err error
+			kelvin, err = dp.Kelvin.Float64()
+			if err != nil || kelvin <= 0 {
+				errMsg := fmt.Sprintf("Invalid kelvin for channelNumber %d: %q is not a positive number", dp.ChannelNumber, dp.Kelvin)
+				log.Println(errMsg)
+				result.Status, result.Code, result.Errors = DeliveryRejected, ErrorInvalidKelvin, []string{errMsg} // This is a data error
+				results = append(results, result)
+				continue
+			}
+		}
+
+		state, _ := hs.state.Update(dp.ChannelNumber, func(previous ChannelState) ChannelState {
+			next := previous
+			if changes.value {
+				next.Value, next.On = valueFloat, valueFloat > 0
+			}
+			if changes.color {
+				next.Color, next.Kelvin = dp.Color, 0 // A new color replaces an earlier color temperature
+			}
+			if changes.kelvin {
+				next.Kelvin = kelvin
+			}
+			if changes.on {
+				next.On = *dp.On
+			}
+			next.UpdatedAt, next.Source = time.Now(), source
+			return next
+		})
+
+		// A data point that passed validation still counts as processed when some of its
+		// publishes fail; its status tells the client whether the fixtures actually got it.
+		outcome := hs.publishChannel(mapping, state, changes)
+		result.Topics = outcome.topics
+		switch {
+		case len(outcome.errors) > 0:
+			result.Status, result.Code, result.Errors = DeliveryFailed, ErrorPublishFailed, outcome.errors
+		case outcome.queued:
+			result.Status = DeliveryQueued
+		case len(outcome.topics) == 0:
+			result.Status = DeliveryUnchanged
+		case outcome.confirmed:
+			result.Status = DeliveryConfirmed
+		default:
+			result.Status = DeliverySent
 		}
 
-		// 3. Publish On/Off state
-		onOffState := "0" // Default to Off
-		if valueFloat > 0 { // Assuming value > 0 means "On"
-			onOffState = "1"
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// summarizeResults counts the data points by status and collects every error
+func summarizeResults(results []DataPointResult) (ResultSummary, []string) {
+	summary := ResultSummary{Total: len(results)}
+	var allErrors []string
+	for _, result := range results {
+		switch result.Status {
+		case DeliveryConfirmed:
+			summary.Confirmed++
+		case DeliverySent:
+			summary.Sent++
+		case DeliveryQueued:
+			summary.Queued++
+		case DeliveryUnchanged:
+			summary.Unchanged++
+		case DeliveryFailed:
+			summary.Failed++
+		case DeliveryRejected:
+			summary.Rejected++
 		}
-		if err := hs.mqttClient.Publish(mapping.OnOffTopic, onOffState); err != nil {
-			errMsg := fmt.Sprintf("Failed to publish on/off state to MQTT topic '%s' for channelNumber %d: %v", mapping.OnOffTopic, dp.ChannelNumber, err)
+		allErrors = append(allErrors, result.Errors...)
+	}
+	summary.Processed = summary.Total - summary.Rejected
+	return summary, allErrors
+}
+
+// formatResults renders one line per data point with its delivery status
+func formatResults(results []DataPointResult) string {
+	var sb strings.Builder
+	for _, result := range results {
+		fmt.Fprintf(&sb, "[%d] channelNumber %d: %s\n", result.Index, result.ChannelNumber, result.Status)
+	}
+	return sb.String()
+}
+
+// channelPublish is a single MQTT message produced for a channel
+type channelPublish struct {
+	attribute string // Name used in logs and errors, e.g. "intensity"
+	topic     string
+	qos       *int // Per-topic overrides of the global settings, may be nil
+	retain    *bool
+	template  string // Payload template, rendered against the channel's PayloadData
+}
+
+// publishOutcome is the result of publishing a channel's messages
+type publishOutcome struct {
+	errors    []string // One message for every publish that failed
+	topics    []string // Topics published or queued, in order
+	queued    bool     // Some message waits in the offline queue because the broker is unreachable
+	confirmed bool     // Every message was published and acknowledged by the broker
+}
+
+// publishChannel publishes a channel's state to the topics of the attributes in changes:
+// intensity for the value, on/off state for the value or on, color and color temperature
+// for the color or kelvin, and emitter levels, which depend on all of them. Topics needing
+// a color are skipped while the channel has none. If state.Kelvin is 0 and the mapping
+// has cctFromColor, the color temperature is approximated from the color.
+func (hs *HTTPServer) publishChannel(mapping ChannelMapping, state ChannelState, changes channelChanges) publishOutcome {
+	var rgb RGB
+	hasColor := state.Color != ""
+	if hasColor {
+		var err error
+		if rgb, err = parseHexColor(state.Color); err != nil {
+			errMsg := fmt.Sprintf("Invalid color for channelNumber %d: %v", mapping.ChannelNumber, err)
 			log.Println(errMsg)
-			publishErrors = append(publishErrors, errMsg)
-		} else {
-			log.Printf("Published on/off state to %s: %s", mapping.OnOffTopic, onOffState)
-		}
-
-		// Consider a data point successfully processed if its initial validation passed,
-		// even if some of its MQTT publishes failed. The publishErrors are for more granular feedback.
-		// Or, only count if all three publishes for this dp succeed.
-		// For now, let's count it if we attempted to publish for it.
-		// A more robust approach might be to check if all publishErrors related to this dp are nil.
-		// Let's refine: only increment successfulMessages if all publishes for this dp were without error.
-		// However, the current publishErrors array is global to the request, not per dp.
-		// So, for now, let's assume a simpler success metric: if we got this far for the dp.
-		// This means `successfulMessages` counts DPs that passed initial validation.
-		// The final response will indicate if there were any `processingErrors` (bad data) or `publishErrors` (MQTT issues).
-
-		successfulMessages++ // Count that we processed this data point structure
-	}
-
-	// Consolidate errors for the response
-	if len(processingErrors) > 0 || len(publishErrors) > 0 {
-		allErrors := append(processingErrors, publishErrors...)
-		log.Printf("%d data points processed. Encountered errors: %v", successfulMessages, allErrors)
-		http.Error(w, fmt.Sprintf("Completed with errors: %v", allErrors), http.StatusMultiStatus) // 207 Multi-Status
-		return
+			return publishOutcome{errors: []string{errMsg}}
+		}
+	}
+	decomposition, err := mapping.decomposition()
+	if err != nil {
+		errMsg := fmt.Sprintf("Invalid color model for channelNumber %d: %v", mapping.ChannelNumber, err)
+		log.Println(errMsg)
+		return publishOutcome{errors: []string{errMsg}}
 	}
 
-	if len(processingErrors) > 0 { // This block is now effectively part of the combined check above.
-		log.Printf("%d messages processed successfully, %d errors.", successfulMessages, len(processingErrors))
-		http.Error(w, fmt.Sprintf("Completed with errors: %v", processingErrors), http.StatusMultiStatus)
-		return
+	scale := mapping.scaling()
+	scaled := scale.apply(state.Value)
+	data := PayloadData{
+		ChannelNumber: mapping.ChannelNumber,
+		Value:         state.Value,
+		Scaled:        scaled,
+		Intensity:     scale.format(scaled),
+		On:            state.On,
+	}
+	emitterFormat := mapping.ColorFormat == ColorFormatEmitters || mapping.ColorFormat == ColorFormatJSONEmitters
+	if hasColor {
+		data.Color = formatColor(rgb, state.Color, mapping.ColorFormat)
+		data.Hex = rgb.Hex()
+		data.Red, data.Green, data.Blue = rgb.R, rgb.G, rgb.B
+		data.Hue, data.Saturation, data.Brightness = rgb.HSV()
+		data.X, data.Y = rgb.XY()
+		level := 0.0
+		if state.On {
+			level = 1 // Fixtures dimming the emitters themselves get them at full level
+			if mapping.EmitterDimming == nil || *mapping.EmitterDimming {
+				level = scale.level(state.Value)
+			}
+		}
+		data.Emitters = decomposition.decompose(rgb, level)
+		if emitterFormat {
+			data.Color = decomposition.format(data.Emitters, mapping.ColorFormat == ColorFormatJSONEmitters)
+		}
+	}
+	kelvin := state.Kelvin
+	if kelvin <= 0 && hasColor && mapping.CCTFromColor != nil && *mapping.CCTFromColor {
+		kelvin = kelvinFromColor(rgb)
+	}
+	if kelvin > 0 {
+		cct := mapping.cct()
+		data.Kelvin = cct.clamp(kelvin)
+		data.Mired = kelvinToMired(data.Kelvin)
+		data.CCT = cct.format(data.Kelvin)
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Successfully processed %d data points.\n", successfulMessages)
+	emittersChanged := hasColor && (changes.value || changes.color || changes.on)
+	var publishes []channelPublish
+	if changes.value {
+		publishes = append(publishes, channelPublish{"intensity", mapping.IntensityTopic, mapping.IntensityQoS, mapping.IntensityRetain, payloadTemplateOrDefault(mapping.IntensityPayload, defaultIntensityPayload)})
+	}
+	if hasColor && (changes.color || emitterFormat && emittersChanged) {
+		publishes = append(publishes, channelPublish{"color", mapping.ColorTopic, mapping.ColorQoS, mapping.ColorRetain, payloadTemplateOrDefault(mapping.ColorPayload, defaultColorPayload)})
+	}
+	if changes.value || changes.on {
+		publishes = append(publishes, channelPublish{"on/off state", mapping.OnOffTopic, mapping.OnOffQoS, mapping.OnOffRetain, payloadTemplateOrDefault(mapping.OnOffPayload, defaultOnOffPayload)})
+	}
+	if mapping.CCTTopic != "" && kelvin > 0 && (changes.color || changes.kelvin) {
+		publishes = append(publishes, channelPublish{"color temperature", mapping.CCTTopic, mapping.CCTQoS, mapping.CCTRetain, payloadTemplateOrDefault(mapping.CCTPayload, defaultCCTPayload)})
+	}
+	// Emitter topics follow the color topic's QoS and retain settings
+	if emittersChanged {
+		for _, emitter := range decomposition.emitters {
+			if topic := mapping.EmitterTopics[emitter]; topic != "" {
+				publishes = append(publishes, channelPublish{emitter + " level", topic, mapping.ColorQoS, mapping.ColorRetain, "{{.Emitters." + emitterField[emitter] + "}}"})
+			}
+		}
+	}
+	return hs.publishAll(data, publishes)
+}
+
+// publishAll renders each message's payload and sends it with its resolved QoS and retain settings, in order
+func (hs *HTTPServer) publishAll(data PayloadData, publishes []channelPublish) publishOutcome {
+	outcome := publishOutcome{confirmed: len(publishes) > 0}
+	cfg, mqttClient := hs.current()
+
+	for _, p := range publishes {
+		payload, err := hs.payloads.render(p.template, data)
+		if err != nil {
+			errMsg := fmt.Sprintf("Failed to build %s payload for MQTT topic '%s' for channelNumber %d: %v", p.attribute, p.topic, data.ChannelNumber, err)
+			log.Println(errMsg)
+			outcome.errors = append(outcome.errors, errMsg)
+			continue
+		}
+
+		qos, retain := cfg.publishSettings(p.qos, p.retain)
+		outcome.confirmed = outcome.confirmed && mqttClient.ConfirmsDelivery(qos)
+		err = mqttClient.Publish(p.topic, qos, retain, payload)
+		switch {
+		case errors.Is(err, ErrPublishQueued):
+			log.Printf("Queued %s for %s until the broker reconnects: %s", p.attribute, p.topic, payload)
+			outcome.topics = append(outcome.topics, p.topic)
+			outcome.queued = true
+		case err != nil:
+			errMsg := fmt.Sprintf("Failed to publish %s to MQTT topic '%s' for channelNumber %d: %v", p.attribute, p.topic, data.ChannelNumber, err)
+			log.Println(errMsg)
+			outcome.errors = append(outcome.errors, errMsg)
+		default:
+			log.Printf("Published %s to %s: %s", p.attribute, p.topic, payload)
+			outcome.topics = append(outcome.topics, p.topic)
+		}
+	}
+
+	return outcome
 }
@@ -4,28 +4,48 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 )
 
 // MockMQTTClient is a mock implementation of the MQTTClient for testing
 type MockMQTTClient struct {
-	PublishFunc       func(topic string, payload interface{}) error
+	PublishFunc       func(topic string, qos byte, retained bool, payload interface{}) error
 	DisconnectFunc    func()
-	PublishedMessages map[string][]string // Store published messages by topic; value is now []string
+	PublishedMessages map[string][]string            // Store published messages by topic; value is now []string
+	PublishedSettings map[string]MockPublishSettings // QoS and retain flag of the last publish per topic
+	ConfirmDelivery   bool                           // Simulates confirmed publish mode
+	MockStatus        MQTTStatus                     // Returned by Status
+	ReconfiguredWith  *Config                        // Last configuration passed to Reconfigure
+	RetiredFor        *Config                        // Configuration passed to Retire
+	Queue             []queuedMessage                // Offline queue, returned by TakeQueue
+	Adopted           []queuedMessage                // Messages passed to AdoptQueue
 	publishLock       sync.Mutex
 }
 
+// MockPublishSettings records the QoS and retain flag a message was published with
+type MockPublishSettings struct {
+	QoS      byte
+	Retained bool
+}
+
 // Publish stores the payload as a string in a slice for the given topic
-func (m *MockMQTTClient) Publish(topic string, payload interface{}) error {
+func (m *MockMQTTClient) Publish(topic string, qos byte, retained bool, payload interface{}) error {
 	m.publishLock.Lock()
 	defer m.publishLock.Unlock()
 
 	if m.PublishedMessages == nil {
 		m.PublishedMessages = make(map[string][]string)
 	}
+	if m.PublishedSettings == nil {
+		m.PublishedSettings = make(map[string]MockPublishSettings)
+	}
+	m.PublishedSettings[topic] = MockPublishSettings{QoS: qos, Retained: retained}
 
 	payloadStr, ok := payload.(string)
 	if !ok {
@@ -37,17 +57,44 @@ func (m *MockMQTTClient) Publish(topic string, payload interface{}) error {
 	m.PublishedMessages[topic] = append(m.PublishedMessages[topic], payloadStr)
 
 	if m.PublishFunc != nil {
-		return m.PublishFunc(topic, payload) // original payload for custom mock func
+		return m.PublishFunc(topic, qos, retained, payload) // original payload for custom mock func
 	}
 	return nil
 }
 
+func (m *MockMQTTClient) ConfirmsDelivery(qos byte) bool {
+	return m.ConfirmDelivery && qos > 0
+}
+
+func (m *MockMQTTClient) Status() MQTTStatus {
+	return m.MockStatus
+}
+
 func (m *MockMQTTClient) Disconnect() {
 	if m.DisconnectFunc != nil {
 		m.DisconnectFunc()
 	}
 }
 
+func (m *MockMQTTClient) Reconfigure(cfg *Config) {
+	m.ReconfiguredWith = cfg
+}
+
+func (m *MockMQTTClient) Retire(next *Config) {
+	m.RetiredFor = next
+	m.Disconnect()
+}
+
+func (m *MockMQTTClient) TakeQueue() []queuedMessage {
+	queue := m.Queue
+	m.Queue = nil
+	return queue
+}
+
+func (m *MockMQTTClient) AdoptQueue(messages []queuedMessage) {
+	m.Adopted = append(m.Adopted, messages...)
+}
+
 // Helper to check if a slice contains a specific string message
 func containsMessage(messages []string, expectedMsg string) bool {
 	for _, msg := range messages {
@@ -203,6 +250,18 @@ func TestHandleDataRequest(t *testing.T) {
 			expectErrorInBody:      true,
 			expectedResponseHeaders: map[string]string{"Access-Control-Allow-Origin": "*"},
 		},
+		{
+			name:   "Malformed color is rejected",
+			method: http.MethodPost,
+			payload: []IncomingDataPoint{
+				{ChannelNumber: 1, Value: json.Number("50"), Color: "red"},
+				{ChannelNumber: 2, Value: json.Number("50"), Color: "#12345G"},
+			},
+			expectedStatusCode:     http.StatusMultiStatus,
+			expectedTotalPublishes: 0,
+			expectErrorInBody:      true,
+			expectedResponseHeaders: map[string]string{"Access-Control-Allow-Origin": "*"},
+		},
 		{
 			name:                   "Invalid value type for a channel (raw JSON)",
 			method:                 http.MethodPost,
@@ -294,3 +353,359 @@ func TestHandleDataRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestPublishSettings(t *testing.T) {
+	qos2 := 2
+	retain := true
+	noRetain := false
+	cfg := &Config{
+		HTTPListenAddr: ":8080",
+		QoS:            1,
+		Retain:         true,
+		ChannelMappings: []ChannelMapping{
+			{ChannelNumber: 1, IntensityTopic: "ch1/intensity", ColorTopic: "ch1/color", OnOffTopic: "ch1/onoff",
+				IntensityRetain: &noRetain, OnOffQoS: &qos2, OnOffRetain: &retain},
+		},
+	}
+	mockMQTT := &MockMQTTClient{}
+	httpServer := NewHTTPServer(cfg, mockMQTT)
+
+	httpServer.processDataPoints([]IncomingDataPoint{{ChannelNumber: 1, Value: json.Number("50"), Color: "#FFFFFF"}}, "test")
+
+	expected := map[string]MockPublishSettings{
+		"ch1/intensity": {QoS: 1, Retained: false}, // Retain overridden, global QoS
+		"ch1/color":     {QoS: 1, Retained: true},  // Global defaults
+		"ch1/onoff":     {QoS: 2, Retained: true},  // QoS overridden
+	}
+	for topic, want := range expected {
+		if got := mockMQTT.PublishedSettings[topic]; got != want {
+			t.Errorf("Topic '%s': expected settings %+v, got %+v", topic, want, got)
+		}
+	}
+}
+
+func TestDeliveryStatus(t *testing.T) {
+	cfg := &Config{
+		HTTPListenAddr: ":8080",
+		QoS:            1,
+		ChannelMappings: []ChannelMapping{
+			{ChannelNumber: 1, IntensityTopic: "ch1/intensity", ColorTopic: "ch1/color", OnOffTopic: "ch1/onoff"},
+			{ChannelNumber: 2, IntensityTopic: "ch2/intensity", ColorTopic: "ch2/color", OnOffTopic: "ch2/onoff"},
+			{ChannelNumber: 3, IntensityTopic: "ch3/intensity", ColorTopic: "ch3/color", OnOffTopic: "ch3/onoff", OnOffQoS: intPtr(0)},
+		},
+	}
+	mockMQTT := &MockMQTTClient{
+		ConfirmDelivery: true,
+		PublishFunc: func(topic string, qos byte, retained bool, payload interface{}) error {
+			if topic == "ch2/color" {
+				return fmt.Errorf("timed out waiting for the broker to acknowledge the message")
+			}
+			return nil
+		},
+	}
+	httpServer := NewHTTPServer(cfg, mockMQTT)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/post", corsMiddleware(httpServer.handleDataRequest))
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	body := `[{"channelNumber":1,"value":10,"color":"#FF0000"},{"channelNumber":2,"value":20,"color":"#00FF00"},{"channelNumber":3,"value":30,"color":"#0000FF"},{"channelNumber":99,"value":40,"color":"#FFFFFF"}]`
+	req, _ := http.NewRequest(http.MethodPost, testServer.URL+"/post", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/plain") // The status lines predate the JSON response
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Errorf("Expected status code %d, got %d", http.StatusMultiStatus, resp.StatusCode)
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	for _, line := range []string{
+		"[0] channelNumber 1: confirmed", // QoS 1 on every topic
+		"[1] channelNumber 2: failed",    // Color publish was not acknowledged
+		"[2] channelNumber 3: sent",      // On/off topic is QoS 0, so not confirmed
+		"[3] channelNumber 99: rejected", // Unknown channel
+	} {
+		if !strings.Contains(string(respBody), line) {
+			t.Errorf("Expected response body to contain %q, got:\n%s", line, respBody)
+		}
+	}
+}
+
+func TestPostJSONResponse(t *testing.T) {
+	cfg := &Config{
+		HTTPListenAddr: ":8080",
+		ChannelMappings: []ChannelMapping{
+			{ChannelNumber: 1, IntensityTopic: "ch1/intensity", ColorTopic: "ch1/color", OnOffTopic: "ch1/onoff"},
+			{ChannelNumber: 2, IntensityTopic: "ch2/intensity", ColorTopic: "ch2/color", OnOffTopic: "ch2/onoff"},
+		},
+	}
+	mockMQTT := &MockMQTTClient{
+		PublishFunc: func(topic string, qos byte, retained bool, payload interface{}) error {
+			if topic == "ch2/color" {
+				return fmt.Errorf("not connected")
+			}
+			return nil
+		},
+	}
+	httpServer := NewHTTPServer(cfg, mockMQTT)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/post", corsMiddleware(httpServer.handleDataRequest))
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	tests := []struct {
+		name               string
+		body               string
+		accept             string
+		expectedStatusCode int
+		expected           PostResponse
+	}{
+		{
+			name:               "All delivered",
+			body:               `[{"channelNumber":1,"value":10,"color":"#FF0000"}]`,
+			expectedStatusCode: http.StatusOK,
+			expected: PostResponse{
+				Status:  "ok",
+				Summary: ResultSummary{Total: 1, Processed: 1, Sent: 1},
+				Results: []DataPointResult{{Index: 0, ChannelNumber: 1, Status: DeliverySent, Topics: []string{"ch1/intensity", "ch1/color", "ch1/onoff"}}},
+			},
+		},
+		{
+			name:               "Rejected and failed data points",
+			body:               `[{"channelNumber":1,"value":10,"color":"red"},{"channelNumber":2,"value":20,"color":"#00FF00"},{"channelNumber":99,"value":30,"color":"#0000FF"}]`,
+			accept:             "application/json, text/plain, */*", // As sent by Angular's HttpClient
+			expectedStatusCode: http.StatusMultiStatus,
+			expected: PostResponse{
+				Status:  "error",
+				Summary: ResultSummary{Total: 3, Processed: 1, Failed: 1, Rejected: 2},
+				Results: []DataPointResult{
+					{Index: 0, ChannelNumber: 1, Status: DeliveryRejected, Code: ErrorInvalidColor},
+					{Index: 1, ChannelNumber: 2, Status: DeliveryFailed, Code: ErrorPublishFailed, Topics: []string{"ch2/intensity", "ch2/onoff"}},
+					{Index: 2, ChannelNumber: 99, Status: DeliveryRejected, Code: ErrorUnknownChannel},
+				},
+			},
+		},
+		{
+			name:               "Malformed request",
+			body:               `{"channelNumber":1}`,
+			expectedStatusCode: http.StatusBadRequest,
+			expected:           PostResponse{Status: "error", Code: ErrorInvalidJSON},
+		},
+		{
+			name:               "Empty request",
+			body:               `[]`,
+			expectedStatusCode: http.StatusBadRequest,
+			expected:           PostResponse{Status: "error", Code: ErrorEmptyRequest},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, testServer.URL+"/post", strings.NewReader(tt.body))
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatusCode {
+				t.Errorf("Expected status code %d, got %d", tt.expectedStatusCode, resp.StatusCode)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected Content-Type application/json, got %s", ct)
+			}
+			var got PostResponse
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if got.Status != tt.expected.Status || got.Code != tt.expected.Code || got.Summary != tt.expected.Summary {
+				t.Errorf("Expected status %q, code %q and summary %+v, got %q, %q and %+v", tt.expected.Status, tt.expected.Code, tt.expected.Summary, got.Status, got.Code, got.Summary)
+			}
+			if (tt.expected.Status == "error") != (len(got.Errors) > 0) {
+				t.Errorf("Expected errors only for status error, got %v", got.Errors)
+			}
+			if len(got.Results) != len(tt.expected.Results) {
+				t.Fatalf("Expected %d results, got %+v", len(tt.expected.Results), got.Results)
+			}
+			for i, want := range tt.expected.Results {
+				result := got.Results[i]
+				if result.Index != want.Index || result.ChannelNumber != want.ChannelNumber || result.Status != want.Status || result.Code != want.Code || !reflect.DeepEqual(result.Topics, want.Topics) {
+					t.Errorf("Result %d: expected %+v, got %+v", i, want, result)
+				}
+				if (want.Code != "") != (len(result.Errors) > 0) {
+					t.Errorf("Result %d: expected error messages only with an error code, got %v", i, result.Errors)
+				}
+			}
+		})
+	}
+}
+
+func TestPartialUpdates(t *testing.T) {
+	cfg := &Config{
+		HTTPListenAddr: ":8080",
+		ChannelMappings: []ChannelMapping{
+			{ChannelNumber: 1, IntensityTopic: "ch1/intensity", ColorTopic: "ch1/color", OnOffTopic: "ch1/onoff", CCTTopic: "ch1/cct"},
+			{ChannelNumber: 2, IntensityTopic: "ch2/intensity", ColorTopic: "ch2/color", OnOffTopic: "ch2/onoff", ColorModel: "rgbw",
+				EmitterTopics: map[string]string{"white": "ch2/white"}},
+		},
+	}
+	mockMQTT := &MockMQTTClient{}
+	httpServer := NewHTTPServer(cfg, mockMQTT)
+	on, off := true, false
+
+	// The steps run in order, each building on the state left by the previous ones
+	steps := []struct {
+		name            string
+		dataPoint       IncomingDataPoint
+		expectedStatus  string
+		expectedPublish map[string]string // Topic to payload; no other topic may be published
+		expectedState   ChannelState      // Value, color, kelvin and on/off state afterwards
+	}{
+		{
+			name:            "Color only before any state",
+			dataPoint:       IncomingDataPoint{ChannelNumber: 1, Color: "#FF0000"},
+			expectedStatus:  DeliverySent,
+			expectedPublish: map[string]string{"ch1/color": "#FF0000"},
+			expectedState:   ChannelState{Color: "#FF0000"},
+		},
+		{
+			name:            "Value only keeps the color",
+			dataPoint:       IncomingDataPoint{ChannelNumber: 1, Value: json.Number("60")},
+			expectedStatus:  DeliverySent,
+			expectedPublish: map[string]string{"ch1/intensity": "60.000000", "ch1/onoff": "1"},
+			expectedState:   ChannelState{Value: 60, Color: "#FF0000", On: true},
+		},
+		{
+			name:            "Color only keeps the fader",
+			dataPoint:       IncomingDataPoint{ChannelNumber: 1, Color: "#0000FF"},
+			expectedStatus:  DeliverySent,
+			expectedPublish: map[string]string{"ch1/color": "#0000FF"},
+			expectedState:   ChannelState{Value: 60, Color: "#0000FF", On: true},
+		},
+		{
+			name:            "Explicit off keeps the value",
+			dataPoint:       IncomingDataPoint{ChannelNumber: 1, On: &off},
+			expectedStatus:  DeliverySent,
+			expectedPublish: map[string]string{"ch1/onoff": "0"},
+			expectedState:   ChannelState{Value: 60, Color: "#0000FF", On: false},
+		},
+		{
+			name:            "Explicit on overrides the value",
+			dataPoint:       IncomingDataPoint{ChannelNumber: 1, Value: json.Number("0"), On: &on},
+			expectedStatus:  DeliverySent,
+			expectedPublish: map[string]string{"ch1/intensity": "0.000000", "ch1/onoff": "1"},
+			expectedState:   ChannelState{Value: 0, Color: "#0000FF", On: true},
+		},
+		{
+			name:            "Kelvin only",
+			dataPoint:       IncomingDataPoint{ChannelNumber: 1, Kelvin: json.Number("2700")},
+			expectedStatus:  DeliverySent,
+			expectedPublish: map[string]string{"ch1/cct": "2700"},
+			expectedState:   ChannelState{Value: 0, Color: "#0000FF", Kelvin: 2700, On: true},
+		},
+		{
+			name:           "Nothing to update",
+			dataPoint:      IncomingDataPoint{ChannelNumber: 1},
+			expectedStatus: DeliveryRejected,
+			expectedState:  ChannelState{Value: 0, Color: "#0000FF", Kelvin: 2700, On: true},
+		},
+		{
+			name:           "Kelvin without a color temperature topic",
+			dataPoint:      IncomingDataPoint{ChannelNumber: 2, Kelvin: json.Number("3000")},
+			expectedStatus: DeliveryUnchanged,
+			expectedState:  ChannelState{Kelvin: 3000},
+		},
+		{
+			name:            "Value only before any color skips the emitters",
+			dataPoint:       IncomingDataPoint{ChannelNumber: 2, Value: json.Number("100")},
+			expectedStatus:  DeliverySent,
+			expectedPublish: map[string]string{"ch2/intensity": "100.000000", "ch2/onoff": "1"},
+			expectedState:   ChannelState{Value: 100, Kelvin: 3000, On: true},
+		},
+		{
+			name:            "Color only updates the emitters at the known intensity",
+			dataPoint:       IncomingDataPoint{ChannelNumber: 2, Color: "#FFFFFF"},
+			expectedStatus:  DeliverySent,
+			expectedPublish: map[string]string{"ch2/color": "#FFFFFF", "ch2/white": "255"},
+			expectedState:   ChannelState{Value: 100, Color: "#FFFFFF", On: true},
+		},
+		{
+			name:            "Switching off dims the emitters",
+			dataPoint:       IncomingDataPoint{ChannelNumber: 2, On: &off},
+			expectedStatus:  DeliverySent,
+			expectedPublish: map[string]string{"ch2/onoff": "0", "ch2/white": "0"},
+			expectedState:   ChannelState{Value: 100, Color: "#FFFFFF", On: false},
+		},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			mockMQTT.PublishedMessages = make(map[string][]string)
+			results := httpServer.processDataPoints([]IncomingDataPoint{step.dataPoint}, "test")
+			if results[0].Status != step.expectedStatus {
+				t.Errorf("Expected status %s, got %+v", step.expectedStatus, results[0])
+			}
+
+			for topic, payload := range step.expectedPublish {
+				if !containsMessage(mockMQTT.PublishedMessages[topic], payload) {
+					t.Errorf("Expected %q on topic %s, got %v", payload, topic, mockMQTT.PublishedMessages[topic])
+				}
+			}
+			for topic, payloads := range mockMQTT.PublishedMessages {
+				if _, ok := step.expectedPublish[topic]; !ok {
+					t.Errorf("Expected nothing on topic %s, got %v", topic, payloads)
+				}
+			}
+
+			state, _ := httpServer.state.Get(step.dataPoint.ChannelNumber)
+			if state.Value != step.expectedState.Value || state.Color != step.expectedState.Color || state.Kelvin != step.expectedState.Kelvin || state.On != step.expectedState.On {
+				t.Errorf("Expected state %+v, got %+v", step.expectedState, state)
+			}
+		})
+	}
+}
+
+func TestPrefersPlainText(t *testing.T) {
+	tests := map[string]bool{
+		"":                                  false,
+		"*/*":                               false,
+		"application/json":                  false,
+		"text/plain":                        true,
+		"text/plain; charset=utf-8":         true,
+		"text/plain, application/json;q=0":  true,
+		"application/json, text/plain, */*": false,
+	}
+	for accept, expected := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/post", nil)
+		req.Header.Set("Accept", accept)
+		if got := prefersPlainText(req); got != expected {
+			t.Errorf("prefersPlainText(Accept: %q) = %t, want %t", accept, got, expected)
+		}
+	}
+}
+
+func TestHandleHealthRequest(t *testing.T) {
+	mockMQTT := &MockMQTTClient{MockStatus: MQTTStatus{Connected: false, QueuedMessages: 12, DroppedMessages: 1}}
+	httpServer := NewHTTPServer(&Config{}, mockMQTT)
+
+	rec := httptest.NewRecorder()
+	httpServer.handleHealthRequest(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+	want := "OK\nmqttConnected: false\nqueuedMessages: 12\ndroppedMessages: 1\n"
+	if rec.Body.String() != want {
+		t.Errorf("Expected body %q, got %q", want, rec.Body.String())
+	}
+}
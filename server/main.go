@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -11,35 +12,81 @@ import (
 )
 
 func main() {
+	// Subcommands run instead of the bridge
+	if len(os.Args) > 1 && os.Args[1] == "import-ofl" {
+		os.Exit(runImportOFL(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	// 1. Parse command-line arguments
-	configPath := flag.String("config", "config.yaml", "Path to the configuration file")
+	configPath := flag.String("config", "config.yaml", "Path to the configuration file; empty to take every setting from LIGHTBOARD_* variables and -set")
+	checkOnly := flag.Bool("check", false, "Validate the configuration file and exit without connecting")
+	watch := flag.Bool("watch", false, "Reload the configuration whenever the file changes, as well as on SIGHUP")
+	var overrides settingsFlag
+	flag.Var(&overrides, "set", "Override a configuration setting, e.g. -set mqttBroker=tcp://broker:1883 (repeatable)")
 	flag.Parse()
 
-	if *configPath == "" {
-		log.Fatal("Configuration file path must be provided via -config flag.")
+	if *configPath == "" && *watch {
+		log.Fatal("-watch needs a configuration file set with -config")
 	}
 
 	// 2. Load the configuration
-	cfg, err := LoadConfig(*configPath)
+	cfg, err := LoadConfig(*configPath, overrides...)
 	if err != nil {
-		log.Fatalf("Failed to load configuration from '%s': %v", *configPath, err)
+		log.Fatalf("Failed to load configuration from %s: %v", configSource(*configPath), err)
+	}
+	if *checkOnly {
+		fmt.Printf("Configuration from %s is valid: %d channels mapped\n", configSource(*configPath), len(cfg.ChannelMappings))
+		return
 	}
-	log.Printf("Configuration loaded successfully from %s", *configPath)
+	log.Printf("Configuration loaded successfully from %s", configSource(*configPath))
 
 	// 3. Initialize the MQTT client
 	mqttClient, err := NewMQTTClient(cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize MQTT client: %v", err)
 	}
-	defer mqttClient.Disconnect() // Ensure MQTT client is disconnected on exit
 
-	// 4. Initialize and Start the HTTP server
+	// 4. Initialize the HTTP server, restoring saved channel state before it starts
 	httpServer := NewHTTPServer(cfg, mqttClient)
+	httpServer.configPath = *configPath
+	defer func() {
+		// A reload may have replaced the client, so disconnect whichever is current
+		_, current := httpServer.current()
+		current.Disconnect()
+	}() // Ensure MQTT client is disconnected on exit
+	if cfg.StateFile != "" {
+		states, err := LoadStateFile(cfg.StateFile)
+		if err != nil {
+			// A damaged state file shouldn't keep the bridge from running the show
+			log.Printf("Failed to restore channel state, starting empty: %v", err)
+		} else {
+			httpServer.RestoreState(states, cfg.RepublishState)
+		}
+
+		persister := NewStatePersister(cfg.StateFile, httpServer.state, stateSaveDelay)
+		persister.Start()
+		defer persister.Stop() // Flush pending changes before exiting
+	}
 
 	// Channel to listen for OS signals for graceful shutdown
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// SIGHUP reloads the configuration without dropping connections
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	if *watch {
+		stopWatching := make(chan struct{})
+		defer close(stopWatching)
+		go watchConfigFile(*configPath, configWatchInterval, stopWatching, func() {
+			log.Printf("Configuration file %s changed", *configPath)
+			select {
+			case reloadChan <- syscall.SIGHUP:
+			default: // A reload is already pending and will read the latest file
+			}
+		})
+	}
+
 	// Channel for errors from the HTTP server
 	errChan := make(chan error, 1)
 
@@ -50,24 +97,32 @@ func main() {
 		}
 	}()
 
-	// 5. Wait for shutdown signal or server error
-	select {
-	case err := <-errChan:
-		log.Fatalf("HTTP server error: %v", err)
-	case sig := <-stopChan:
-		log.Printf("Received signal %v. Starting graceful shutdown...", sig)
+	// 5. Wait for shutdown signal or server error, reloading the configuration on request
+	for {
+		select {
+		case <-reloadChan:
+			log.Printf("Reloading configuration from %s", configSource(*configPath))
+			if err := reloadConfig(*configPath, overrides, httpServer, connectForReload); err != nil {
+				log.Printf("Configuration reload failed: %v", err)
+			}
+		case err := <-errChan:
+			log.Fatalf("HTTP server error: %v", err)
+		case sig := <-stopChan:
+			log.Printf("Received signal %v. Starting graceful shutdown...", sig)
 
-		// Create a context with a timeout for the shutdown
-		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancelShutdown()
+			// Create a context with a timeout for the shutdown
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancelShutdown()
 
-		if err := httpServer.Shutdown(shutdownCtx); err != nil {
-			log.Printf("HTTP server shutdown error: %v", err)
-		} else {
-			log.Println("HTTP server gracefully stopped.")
-		}
+			if err := httpServer.Shutdown(shutdownCtx); err != nil {
+				log.Printf("HTTP server shutdown error: %v", err)
+			} else {
+				log.Println("HTTP server gracefully stopped.")
+			}
 
-		// MQTT client is disconnected via defer
-		log.Println("Application shut down gracefully.")
+			// MQTT client is disconnected via defer
+			log.Println("Application shut down gracefully.")
+			return
+		}
 	}
 }
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -10,12 +12,29 @@ import (
 
 // MQTTClient wraps the Paho MQTT client
 type MQTTClient struct {
-	client mqtt.Client
-	config *Config
+	client       mqtt.Client
+	connectToken mqtt.Token             // Completes once the first connection is made
+	config       atomic.Pointer[Config] // Replaced by Reconfigure when the configuration is reloaded
+	queue        *publishQueue          // Latest message per topic while disconnected; nil if disabled
+	flushLock    sync.Mutex             // Serializes replays of the queue
+	flushing     atomic.Bool            // Set while the queue is being replayed
+}
+
+// MQTTStatus describes the health of the MQTT connection for /health
+type MQTTStatus struct {
+	Connected       bool
+	QueuedMessages  int // Messages waiting in the offline queue
+	DroppedMessages int // Messages discarded because the offline queue was full
 }
 
 // NewMQTTClient creates and connects an MQTT client
 func NewMQTTClient(cfg *Config) (*MQTTClient, error) {
+	m := &MQTTClient{}
+	m.config.Store(cfg)
+	if *cfg.MQTTOfflineQueue {
+		m.queue = newPublishQueue(cfg.MQTTOfflineQueueSize)
+	}
+
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.MQTTBroker)
 	opts.SetClientID(cfg.MQTTClientID)
@@ -26,12 +45,31 @@ func NewMQTTClient(cfg *Config) (*MQTTClient, error) {
 		opts.SetPassword(cfg.MQTTPassword)
 	}
 
-	opts.SetKeepAlive(60 * time.Second)
-	opts.SetPingTimeout(5 * time.Second) // Increased from 2 to 5 for more leniency
-	opts.SetConnectTimeout(10 * time.Second) // Increased from 5 to 10
-	opts.SetAutoReconnect(true)
-	opts.SetMaxReconnectInterval(1 * time.Minute)
-	opts.SetCleanSession(true) // Important for bridge scenarios to not miss messages if broker expects it
+	if cfg.MQTTTLS != nil {
+		tlsConfig, err := buildTLSConfig(cfg.MQTTTLS)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.MQTTTLS.InsecureSkipVerify {
+			log.Println("WARNING: MQTT broker certificate verification is disabled (mqttTls.insecureSkipVerify)")
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	opts.SetKeepAlive(time.Duration(cfg.MQTTKeepAliveSeconds) * time.Second)
+	opts.SetPingTimeout(time.Duration(cfg.MQTTPingTimeoutSeconds) * time.Second)
+	opts.SetConnectTimeout(time.Duration(cfg.MQTTConnectTimeoutSeconds) * time.Second)
+	opts.SetAutoReconnect(*cfg.MQTTAutoReconnect)
+	opts.SetMaxReconnectInterval(time.Duration(cfg.MQTTMaxReconnectIntervalSeconds) * time.Second)
+	opts.SetCleanSession(*cfg.MQTTCleanSession) // Important for bridge scenarios to not miss messages if broker expects it
+	opts.SetConnectRetry(*cfg.MQTTConnectRetry)
+	opts.SetConnectRetryInterval(time.Duration(cfg.MQTTConnectRetryIntervalSeconds) * time.Second)
+
+	// Last Will: the broker announces we're offline if the connection drops without a clean disconnect
+	will := cfg.MQTTWill
+	if will != nil {
+		opts.SetWill(will.Topic, will.Payload, byte(will.QoS), *will.Retained)
+	}
 
 	// Connection Lost Handler
 	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
@@ -42,6 +80,18 @@ func NewMQTTClient(cfg *Config) (*MQTTClient, error) {
 	opts.SetOnConnectHandler(func(client mqtt.Client) {
 		log.Println("Successfully connected to MQTT broker")
 		// You could subscribe to topics here if needed, but this service primarily publishes
+
+		// Birth message: overwrite the (possibly retained) Last Will now that we're back.
+		// Don't wait on the token here; blocking in the connect handler stalls the client.
+		if will != nil {
+			client.Publish(will.Topic, byte(will.QoS), *will.Retained, will.BirthPayload)
+			log.Printf("Published birth message to %s: %s", will.Topic, will.BirthPayload)
+		}
+
+		// Replay whatever was published while we were disconnected
+		if m.queue != nil {
+			go m.flushQueue()
+		}
 	})
 
 	// Reconnect Handler (called when a reconnect attempt is successful)
@@ -50,30 +100,180 @@ func NewMQTTClient(cfg *Config) (*MQTTClient, error) {
 	})
 
 	client := mqtt.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
+	m.client = client
+	token := client.Connect()
+	m.connectToken = token
+	if *cfg.MQTTConnectRetry {
+		// Paho retries in the background until the broker is reachable, and holds publishes
+		// until then. Don't wait here, so the HTTP server can start while the broker boots.
+		log.Printf("Connecting to MQTT broker %s in the background, retrying every %ds", cfg.MQTTBroker, cfg.MQTTConnectRetryIntervalSeconds)
+		go func() {
+			if token.Wait() && token.Error() != nil {
+				log.Printf("Failed to connect to MQTT broker %s: %v", cfg.MQTTBroker, token.Error())
+			}
+		}()
+		return m, nil
+	}
+	if token.Wait() && token.Error() != nil {
 		return nil, fmt.Errorf("failed to connect to MQTT broker %s: %w", cfg.MQTTBroker, token.Error())
 	}
 
 	log.Printf("MQTT client connected to %s with ClientID: %s", cfg.MQTTBroker, cfg.MQTTClientID)
-	return &MQTTClient{client: client, config: cfg}, nil
+	return m, nil
+}
+
+// Publish publishes a message to the given topic with the given QoS and retain flag.
+// In confirmed mode, QoS 1 and 2 publishes block until the broker acknowledges them and
+// return the real error; otherwise Publish returns immediately and failures are only logged.
+// While the broker is unreachable, messages go to the offline queue and ErrPublishQueued
+// is returned.
+func (m *MQTTClient) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	// Keep queueing while a replay is in progress, so a fresh value can't overtake an older queued one
+	if m.queue != nil && (m.flushing.Load() || !m.client.IsConnectionOpen()) {
+		m.queue.Push(queuedMessage{topic: topic, qos: qos, retained: retained, payload: payload})
+		// The connection may have come back between the check and the push; replay now
+		// rather than leaving the message stranded until the next reconnect
+		if m.client.IsConnectionOpen() && !m.flushing.Load() {
+			go m.flushQueue()
+		}
+		return ErrPublishQueued
+	}
+
+	token := m.client.Publish(topic, qos, retained, payload)
+	if m.ConfirmsDelivery(qos) {
+		timeout := time.Duration(m.config.Load().MQTTPublishTimeoutMillis) * time.Millisecond
+		if !token.WaitTimeout(timeout) {
+			return fmt.Errorf("timed out after %v waiting for the broker to acknowledge the message", timeout)
+		}
+		return token.Error()
+	}
+
+	m.logPublishFailure(topic, token)
+	return nil // Return immediately for async publishing
 }
 
-// Publish publishes a message to the given topic
-func (m *MQTTClient) Publish(topic string, payload interface{}) error {
-	token := m.client.Publish(topic, 0, false, payload) // Using QoS 0, non-retained for now
-	// token.Wait() // Can wait for confirmation, but for high throughput, might not be necessary
-	// For fire-and-forget, we might not wait. If delivery confirmation is critical, WaitTimeout.
+// logPublishFailure logs the outcome of a publish we aren't waiting for
+func (m *MQTTClient) logPublishFailure(topic string, token mqtt.Token) {
 	go func() { // Asynchronous handling of the token
 		if token.WaitTimeout(5*time.Second) && token.Error() != nil {
 			log.Printf("Failed to publish message to topic %s: %v", topic, token.Error())
 		}
 	}()
-	return nil // Return immediately for async publishing
+}
+
+// flushQueue replays the offline queue, oldest first. If the connection drops again
+// part-way through, the unsent messages are put back for the next reconnect.
+func (m *MQTTClient) flushQueue() {
+	m.flushLock.Lock()
+	defer m.flushLock.Unlock()
+
+	m.flushing.Store(true)
+	defer m.flushing.Store(false)
+	for {
+		messages := m.queue.Drain()
+		if len(messages) == 0 {
+			// A Publish may have queued a message just before we clear the flag
+			m.flushing.Store(false)
+			if m.queue.Len() == 0 {
+				return
+			}
+			m.flushing.Store(true)
+			continue
+		}
+
+		log.Printf("Replaying %d messages queued while the MQTT broker was unreachable", len(messages))
+		for i, msg := range messages {
+			if !m.client.IsConnectionOpen() {
+				log.Printf("MQTT connection lost during replay, requeueing %d messages", len(messages)-i)
+				m.queue.Requeue(messages[i:])
+				return
+			}
+			m.logPublishFailure(msg.topic, m.client.Publish(msg.topic, msg.qos, msg.retained, msg.payload))
+		}
+	}
+}
+
+// Status reports the connection state and offline queue depth
+func (m *MQTTClient) Status() MQTTStatus {
+	status := MQTTStatus{Connected: m.client.IsConnectionOpen()}
+	if m.queue != nil {
+		status.QueuedMessages = m.queue.Len()
+		status.DroppedMessages = m.queue.Dropped()
+	}
+	return status
+}
+
+// ConfirmsDelivery reports whether Publish waits for the broker's acknowledgement at this QoS
+func (m *MQTTClient) ConfirmsDelivery(qos byte) bool {
+	return m.config.Load().MQTTConfirmPublish && qos > 0
+}
+
+// WaitConnected waits up to timeout for the first connection to the broker, and reports
+// whether it was made. With mqttConnectRetry, NewMQTTClient returns before that.
+func (m *MQTTClient) WaitConnected(timeout time.Duration) bool {
+	return m.connectToken.WaitTimeout(timeout) && m.connectToken.Error() == nil
+}
+
+// TakeQueue empties the offline queue and returns its messages, oldest first
+func (m *MQTTClient) TakeQueue() []queuedMessage {
+	if m.queue == nil {
+		return nil
+	}
+	return m.queue.Drain()
+}
+
+// AdoptQueue sends the messages another client queued before this one replaced it. They
+// are older than anything published through this client since, so topics queued here
+// already keep their message, and new publishes wait until the replay is done.
+func (m *MQTTClient) AdoptQueue(messages []queuedMessage) {
+	if len(messages) == 0 {
+		return
+	}
+	if m.queue == nil {
+		for _, msg := range messages {
+			m.logPublishFailure(msg.topic, m.client.Publish(msg.topic, msg.qos, msg.retained, msg.payload))
+		}
+		return
+	}
+
+	m.queue.Requeue(messages)
+	if m.client.IsConnectionOpen() {
+		m.flushing.Store(true) // Until flushQueue takes over, so no publish overtakes the replay
+		go m.flushQueue()
+	}
+}
+
+// Reconfigure adopts the publish settings (mqttConfirmPublish, mqttPublishTimeoutMs) of a
+// reloaded configuration. Connection settings only change by connecting a new client.
+func (m *MQTTClient) Reconfigure(cfg *Config) {
+	m.config.Store(cfg)
 }
 
 // Disconnect disconnects the MQTT client
 func (m *MQTTClient) Disconnect() {
+	m.disconnect(true)
+}
+
+// Retire disconnects a client replaced by a reload with the next configuration. The
+// new client has announced itself already, so the offline status is only published if
+// it went to a status topic the new client doesn't use.
+func (m *MQTTClient) Retire(next *Config) {
+	will := m.config.Load().MQTTWill
+	m.disconnect(will != nil && (next.MQTTWill == nil || next.MQTTWill.Topic != will.Topic))
+}
+
+// disconnect disconnects the MQTT client, first publishing the offline status if announce is set
+func (m *MQTTClient) disconnect(announce bool) {
 	if m.client.IsConnected() {
+		// Paho does not send the Last Will on a clean disconnect, so announce it ourselves
+		if will := m.config.Load().MQTTWill; will != nil && announce && m.client.IsConnectionOpen() {
+			token := m.client.Publish(will.Topic, byte(will.QoS), *will.Retained, will.Payload)
+			if !token.WaitTimeout(time.Second) {
+				log.Printf("Failed to publish offline status to %s: timed out after %v", will.Topic, time.Second)
+			} else if token.Error() != nil {
+				log.Printf("Failed to publish offline status to %s: %v", will.Topic, token.Error())
+			}
+		}
 		log.Println("Disconnecting MQTT client...")
 		m.client.Disconnect(250) // 250ms timeout for disconnection
 	}
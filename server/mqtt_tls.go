@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// MQTTTLSConfig holds the TLS settings for connecting to an ssl:// or mqtts:// broker
+type MQTTTLSConfig struct {
+	CAFile             string `yaml:"caFile,omitempty"`             // PEM bundle of CAs trusted for the broker certificate; system roots if empty
+	CertFile           string `yaml:"certFile,omitempty"`           // PEM client certificate, for brokers requiring client-certificate authentication
+	KeyFile            string `yaml:"keyFile,omitempty"`            // PEM private key for CertFile
+	ServerName         string `yaml:"serverName,omitempty"`         // Overrides the host name checked against the broker certificate
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty"` // Disables broker certificate verification. For lab use only!
+}
+
+// tlsBrokerSchemes are the broker URL schemes paho connects to over TLS
+var tlsBrokerSchemes = []string{"ssl", "tls", "mqtts", "mqtt+ssl", "tcps", "wss"}
+
+// isTLSBroker reports whether the broker URL uses a TLS scheme
+func isTLSBroker(broker string) bool {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return false
+	}
+	for _, scheme := range tlsBrokerSchemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildTLSConfig loads the CA bundle and client key pair into a tls.Config.
+// It is used both by LoadConfig, to validate the files, and by NewMQTTClient.
+func buildTLSConfig(cfg *MQTTTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if cfg.CAFile != "" {
+		caPEM, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mqttTls.caFile '%s': %w", cfg.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("mqttTls.caFile '%s' does not contain any PEM certificates", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, fmt.Errorf("mqttTls.certFile and mqttTls.keyFile must be set together")
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load mqttTls client certificate '%s' and key '%s': %w", cfg.CertFile, cfg.KeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCertificate writes a self-signed certificate and its key as PEM files
+func writeTestCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "lightboard-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, tempDir)
+	notPEM := filepath.Join(tempDir, "not.pem")
+	if err := os.WriteFile(notPEM, []byte("definitely not a certificate"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		cfg         MQTTTLSConfig
+		expectError bool
+	}{
+		{name: "Empty config uses system roots", cfg: MQTTTLSConfig{}},
+		{name: "CA bundle", cfg: MQTTTLSConfig{CAFile: certFile}},
+		{name: "Client certificate", cfg: MQTTTLSConfig{CAFile: certFile, CertFile: certFile, KeyFile: keyFile, ServerName: "broker.local"}},
+		{name: "Missing CA file", cfg: MQTTTLSConfig{CAFile: filepath.Join(tempDir, "missing.pem")}, expectError: true},
+		{name: "CA file is not PEM", cfg: MQTTTLSConfig{CAFile: notPEM}, expectError: true},
+		{name: "Certificate without key", cfg: MQTTTLSConfig{CertFile: certFile}, expectError: true},
+		{name: "Key is not PEM", cfg: MQTTTLSConfig{CertFile: certFile, KeyFile: notPEM}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := buildTLSConfig(&tt.cfg)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("buildTLSConfig() expected an error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildTLSConfig() unexpected error: %v", err)
+			}
+			if tt.cfg.CAFile != "" && tlsConfig.RootCAs == nil {
+				t.Error("Expected RootCAs to be set from caFile")
+			}
+			if tt.cfg.CertFile != "" && len(tlsConfig.Certificates) != 1 {
+				t.Error("Expected client certificate to be loaded")
+			}
+			if tlsConfig.ServerName != tt.cfg.ServerName {
+				t.Errorf("Expected ServerName %q, got %q", tt.cfg.ServerName, tlsConfig.ServerName)
+			}
+		})
+	}
+}
+
+func TestIsTLSBroker(t *testing.T) {
+	for broker, want := range map[string]bool{
+		"ssl://broker:8883":   true,
+		"mqtts://broker:8883": true,
+		"TLS://broker:8883":   true,
+		"tcp://broker:1883":   false,
+		"broker:1883":         false,
+	} {
+		if got := isTLSBroker(broker); got != want {
+			t.Errorf("isTLSBroker(%q) = %v, want %v", broker, got, want)
+		}
+	}
+}
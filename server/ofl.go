@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultOFLTopicPattern is the topic prefix given to fixtures imported from the Open
+// Fixture Library. Each attribute gets its own topic below it, e.g. ".../intensity".
+const defaultOFLTopicPattern = "lightboard/fixture/{id}"
+
+// oflIndexFiles are the non-fixture JSON files at the top of the Open Fixture Library's
+// fixtures directory, skipped when loading a checkout of it
+var oflIndexFiles = map[string]bool{"manufacturers.json": true, "register.json": true}
+
+// oflFixture is the part of an Open Fixture Library fixture definition the bridge uses.
+// See https://github.com/OpenLightingProject/open-fixture-library/blob/master/docs/fixture-format.md
+type oflFixture struct {
+	Name              string                     `json:"name"`
+	AvailableChannels map[string]oflChannel      `json:"availableChannels"`
+	TemplateChannels  map[string]json.RawMessage `json:"templateChannels"`
+	Modes             []oflMode                  `json:"modes"`
+}
+
+type oflChannel struct {
+	FineChannelAliases []string        `json:"fineChannelAliases"`
+	Capability         *oflCapability  `json:"capability"`
+	Capabilities       []oflCapability `json:"capabilities"`
+}
+
+type oflCapability struct {
+	Type                  string `json:"type"`
+	Color                 string `json:"color"`
+	ColorTemperature      string `json:"colorTemperature"`
+	ColorTemperatureStart string `json:"colorTemperatureStart"`
+	ColorTemperatureEnd   string `json:"colorTemperatureEnd"`
+}
+
+type oflMode struct {
+	Name      string            `json:"name"`
+	ShortName string            `json:"shortName"`
+	Channels  []json.RawMessage `json:"channels"` // Channel keys, null, or matrix channel insert blocks
+}
+
+// oflEmitters maps Open Fixture Library ColorIntensity colors onto the bridge's emitters
+var oflEmitters = map[string]string{
+	"Red":   EmitterRed,
+	"Green": EmitterGreen,
+	"Blue":  EmitterBlue,
+	"White": EmitterWhite,
+	"Amber": EmitterAmber,
+	"UV":    EmitterUV,
+}
+
+// colorModelsBySize lists the color models from most to fewest emitters, so the first
+// one whose emitters a fixture has is the best fit
+var colorModelsBySize = []string{ColorModelRGBWAUV, ColorModelRGBWA, ColorModelRGBW, ColorModelRGBA, ColorModelRGB}
+
+// oflConversion is the result of converting an Open Fixture Library fixture
+type oflConversion struct {
+	Profile     FixtureProfile
+	Mode        string   // Name of the mode whose channels were converted
+	Unsupported []string // Channels and capabilities the bridge can't drive, for the user to review
+}
+
+// convertOFLFixture converts an Open Fixture Library fixture definition into a fixture
+// profile named name. The channels of the named mode are used, or of the mode with the
+// most channels if mode is empty. Topics are topicPattern followed by the attribute,
+// e.g. "lightboard/fixture/{id}/intensity".
+func convertOFLFixture(data []byte, name, topicPattern, mode string) (oflConversion, error) {
+	var fixture oflFixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return oflConversion{}, fmt.Errorf("invalid fixture JSON: %w", err)
+	}
+	if len(fixture.AvailableChannels) == 0 {
+		return oflConversion{}, fmt.Errorf("not an Open Fixture Library fixture: no availableChannels")
+	}
+
+	var result oflConversion
+	unsupported := func(format string, args ...interface{}) {
+		result.Unsupported = append(result.Unsupported, fmt.Sprintf(format, args...))
+	}
+
+	channelKeys, modeName, err := oflModeChannels(fixture, mode)
+	if err != nil {
+		return oflConversion{}, err
+	}
+	result.Mode = modeName
+
+	// Fine channels carry the low byte of a 16-bit coarse channel, which is converted instead
+	fineAliases := make(map[string]string)
+	for key, channel := range fixture.AvailableChannels {
+		for _, alias := range channel.FineChannelAliases {
+			fineAliases[alias] = key
+		}
+	}
+
+	hasIntensity, hasCCT := false, false
+	var cctMin, cctMax float64          // Zero if the fixture gives no temperatures in Kelvin
+	emitters := make(map[string]string) // Emitter to the channel providing it
+
+	for _, key := range channelKeys {
+		channel, ok := fixture.AvailableChannels[key]
+		if !ok {
+			if coarse, isFine := fineAliases[key]; isFine {
+				unsupported("channel %q: fine channel of %q, only 8-bit levels are published", key, coarse)
+			} else {
+				unsupported("channel %q: template or matrix channel", key)
+			}
+			continue
+		}
+
+		capabilities := channel.Capabilities
+		if channel.Capability != nil {
+			capabilities = append(capabilities, *channel.Capability)
+		}
+		reported := make(map[string]bool)
+		for _, capability := range capabilities {
+			switch capability.Type {
+			case "Intensity":
+				hasIntensity = true
+			case "ColorIntensity":
+				emitter, ok := oflEmitters[capability.Color]
+				if !ok {
+					unsupported("channel %q: ColorIntensity %s", key, capability.Color)
+					continue
+				}
+				emitters[emitter] = key
+			case "ColorTemperature":
+				hasCCT = true
+				for _, bound := range []string{capability.ColorTemperatureStart, capability.ColorTemperatureEnd, capability.ColorTemperature} {
+					kelvin, ok := parseOFLKelvin(bound)
+					if !ok {
+						continue
+					}
+					if cctMin == 0 || kelvin < cctMin {
+						cctMin = kelvin
+					}
+					if kelvin > cctMax {
+						cctMax = kelvin
+					}
+				}
+			case "NoFunction":
+			default:
+				if !reported[capability.Type] {
+					unsupported("channel %q: %s", key, capability.Type)
+					reported[capability.Type] = true
+				}
+			}
+		}
+	}
+
+	// Levels are published as DMX values
+	dmxMax := 255.0
+	base := strings.TrimSuffix(topicPattern, "/")
+	mapping := ChannelMapping{
+		IntensityTopic: base + "/intensity",
+		ColorTopic:     base + "/color",
+		OnOffTopic:     base + "/onoff",
+		OutputMax:      &dmxMax,
+		Rounding:       RoundingNearest,
+	}
+
+	if len(emitters) > 0 {
+		for _, model := range colorModelsBySize {
+			fits := true
+			for _, emitter := range colorModelEmitters[model] {
+				if _, ok := emitters[emitter]; !ok {
+					fits = false
+					break
+				}
+			}
+			if !fits {
+				continue
+			}
+			if model != ColorModelRGB {
+				mapping.ColorModel = model
+			}
+			mapping.EmitterTopics = make(map[string]string)
+			for _, emitter := range colorModelEmitters[model] {
+				mapping.EmitterTopics[emitter] = base + "/" + emitter
+				delete(emitters, emitter)
+			}
+			break
+		}
+		// Emitters left over don't fit a color model, e.g. UV without white and amber
+		for _, emitter := range sortedKeys(emitters) {
+			unsupported("channel %q: %s emitter without a matching color model", emitters[emitter], emitter)
+		}
+	}
+
+	if hasIntensity && mapping.EmitterTopics != nil {
+		// The fixture's master dimmer, fed by the intensity topic, already dims the emitters
+		emitterDimming := false
+		mapping.EmitterDimming = &emitterDimming
+	}
+	if hasCCT {
+		mapping.CCTTopic = base + "/cct"
+		if cctMin < cctMax {
+			mapping.CCTMin, mapping.CCTMax = &cctMin, &cctMax
+		}
+	}
+	if !hasIntensity && mapping.EmitterTopics == nil && !hasCCT {
+		unsupported("fixture: no intensity, color or color temperature channels")
+	}
+
+	description := fixture.Name
+	if description == "" {
+		description = name
+	}
+	if modeName != "" {
+		description += " (" + modeName + ")"
+	}
+	result.Profile = FixtureProfile{Name: name, Description: description, ChannelMapping: mapping}
+	return result, nil
+}
+
+// oflModeChannels returns the channel keys of the named mode, or of the largest mode.
+// A fixture without modes uses all of its channels.
+func oflModeChannels(fixture oflFixture, name string) ([]string, string, error) {
+	if len(fixture.Modes) == 0 {
+		if name != "" {
+			return nil, "", fmt.Errorf("fixture has no mode %q", name)
+		}
+		return sortedKeys(fixture.AvailableChannels), "", nil
+	}
+
+	selected := -1
+	for i, mode := range fixture.Modes {
+		if name != "" {
+			if strings.EqualFold(mode.Name, name) || strings.EqualFold(mode.ShortName, name) {
+				selected = i
+				break
+			}
+		} else if selected < 0 || len(mode.Channels) > len(fixture.Modes[selected].Channels) {
+			selected = i
+		}
+	}
+	if selected < 0 {
+		var names []string
+		for _, mode := range fixture.Modes {
+			names = append(names, mode.Name)
+		}
+		return nil, "", fmt.Errorf("fixture has no mode %q, available modes: %s", name, strings.Join(names, ", "))
+	}
+
+	mode := fixture.Modes[selected]
+	var keys []string
+	for _, raw := range mode.Channels {
+		var key *string
+		if err := json.Unmarshal(raw, &key); err != nil {
+			// A matrix channel insert block rather than a channel key
+			keys = append(keys, "matrix channels")
+			continue
+		}
+		if key != nil {
+			keys = append(keys, *key)
+		}
+	}
+	return keys, mode.Name, nil
+}
+
+// parseOFLKelvin parses an Open Fixture Library color temperature like "3200K". Relative
+// values such as "warm" or "CTO" have no fixed temperature and are not parsed.
+func parseOFLKelvin(s string) (float64, bool) {
+	if !strings.HasSuffix(s, "K") {
+		return 0, false
+	}
+	kelvin, err := strconv.ParseFloat(strings.TrimSuffix(s, "K"), 64)
+	if err != nil || kelvin <= 0 {
+		return 0, false
+	}
+	return kelvin, true
+}
+
+// oflProfileName names a profile after its Open Fixture Library fixture key, which is the
+// manufacturer directory and file name, e.g. "cameo/flat-pro-18". A file given without
+// a directory is named after the file alone.
+func oflProfileName(file string) string {
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	dir := filepath.Base(filepath.Dir(file))
+	if dir == "." || dir == string(filepath.Separator) {
+		return base
+	}
+	return dir + "/" + base
+}
+
+// loadOFLProfile reads an Open Fixture Library fixture file as a fixture profile
+func loadOFLProfile(file, topicPattern string) (FixtureProfile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return FixtureProfile{}, fmt.Errorf("failed to read fixture '%s': %w", file, err)
+	}
+	conversion, err := convertOFLFixture(data, oflProfileName(file), topicPattern, "")
+	if err != nil {
+		return FixtureProfile{}, fmt.Errorf("failed to import fixture '%s': %w", file, err)
+	}
+	return conversion.Profile, nil
+}
+
+// runImportOFL implements the import-ofl subcommand, which converts an Open Fixture
+// Library fixture file into a fixture profile and reports what it could not convert
+func runImportOFL(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("import-ofl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	name := flags.String("name", "", "Profile name (default: the fixture key, e.g. cameo/flat-pro-18)")
+	mode := flags.String("mode", "", "Fixture mode to convert, by name or short name (default: the mode with the most channels)")
+	topicPattern := flags.String("topic", defaultOFLTopicPattern, "Topic prefix for the fixture's attributes; may contain {id}")
+	output := flags.String("o", "", "Write the profile to this file instead of standard output")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: lightboard-server import-ofl [flags] <fixture.json>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	file := flags.Arg(0)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to read fixture: %v\n", err)
+		return 1
+	}
+	profileName := *name
+	if profileName == "" {
+		profileName = oflProfileName(file)
+	}
+	conversion, err := convertOFLFixture(data, profileName, *topicPattern, *mode)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to convert '%s': %v\n", file, err)
+		return 1
+	}
+
+	// Indented like the bundled profiles
+	var profileYAML bytes.Buffer
+	encoder := yaml.NewEncoder(&profileYAML)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(conversion.Profile); err != nil {
+		fmt.Fprintf(stderr, "Failed to encode profile: %v\n", err)
+		return 1
+	}
+	if err := encoder.Close(); err != nil {
+		fmt.Fprintf(stderr, "Failed to encode profile: %v\n", err)
+		return 1
+	}
+	content := fmt.Sprintf("# Converted from the Open Fixture Library fixture %s\n", filepath.Base(file))
+	if conversion.Mode != "" {
+		content += fmt.Sprintf("# Mode: %s\n", conversion.Mode)
+	}
+	for _, item := range conversion.Unsupported {
+		content += fmt.Sprintf("# Unsupported: %s\n", item)
+	}
+	content += profileYAML.String()
+
+	if *output == "" {
+		fmt.Fprint(stdout, content)
+	} else if err := os.WriteFile(*output, []byte(content), 0644); err != nil {
+		fmt.Fprintf(stderr, "Failed to write profile: %v\n", err)
+		return 1
+	}
+
+	for _, item := range conversion.Unsupported {
+		fmt.Fprintf(stderr, "Unsupported: %s\n", item)
+	}
+	return 0
+}
+
+// sortedKeys returns the keys of a string-keyed map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
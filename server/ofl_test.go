@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConvertOFLFixture(t *testing.T) {
+	tests := []struct {
+		name                string
+		file                string
+		mode                string
+		expectedMode        string
+		expectedMapping     ChannelMapping
+		expectedUnsupported []string
+		expectError         bool
+	}{
+		{
+			name:         "Dimmer and RGBW",
+			file:         "testdata/ofl/generic/drgbw-fader.json",
+			expectedMode: "5-channel",
+			expectedMapping: ChannelMapping{
+				IntensityTopic: "fx/{id}/intensity", ColorTopic: "fx/{id}/color", OnOffTopic: "fx/{id}/onoff",
+				OutputMax: floatPtr(255), Rounding: RoundingNearest, ColorModel: ColorModelRGBW,
+				EmitterTopics:  map[string]string{"red": "fx/{id}/red", "green": "fx/{id}/green", "blue": "fx/{id}/blue", "white": "fx/{id}/white"},
+				EmitterDimming: boolPtr(false),
+			},
+		},
+		{
+			name:         "Unsupported colors",
+			file:         "testdata/ofl/generic/cmy-fader.json",
+			expectedMode: "3-channel",
+			expectedMapping: ChannelMapping{
+				IntensityTopic: "fx/{id}/intensity", ColorTopic: "fx/{id}/color", OnOffTopic: "fx/{id}/onoff",
+				OutputMax: floatPtr(255), Rounding: RoundingNearest,
+			},
+			expectedUnsupported: []string{
+				`channel "Cyan": ColorIntensity Cyan`,
+				`channel "Magenta": ColorIntensity Magenta`,
+				`channel "Yellow": ColorIntensity Yellow`,
+				"fixture: no intensity, color or color temperature channels",
+			},
+		},
+		{
+			name:         "Largest mode by default",
+			file:         "testdata/ofl/example/tunable-white-spot.json",
+			expectedMode: "Extended",
+			expectedMapping: ChannelMapping{
+				IntensityTopic: "fx/{id}/intensity", ColorTopic: "fx/{id}/color", OnOffTopic: "fx/{id}/onoff",
+				OutputMax: floatPtr(255), Rounding: RoundingNearest,
+				CCTTopic: "fx/{id}/cct", CCTMin: floatPtr(2700), CCTMax: floatPtr(6500),
+			},
+			expectedUnsupported: []string{
+				`channel "Pan": Pan`,
+				`channel "Dimmer fine": fine channel of "Dimmer", only 8-bit levels are published`,
+				`channel "Shutter": ShutterStrobe`,
+			},
+		},
+		{
+			name:         "Mode by short name",
+			file:         "testdata/ofl/example/tunable-white-spot.json",
+			mode:         "3ch",
+			expectedMode: "Basic",
+			expectedMapping: ChannelMapping{
+				IntensityTopic: "fx/{id}/intensity", ColorTopic: "fx/{id}/color", OnOffTopic: "fx/{id}/onoff",
+				OutputMax: floatPtr(255), Rounding: RoundingNearest,
+				CCTTopic: "fx/{id}/cct", CCTMin: floatPtr(2700), CCTMax: floatPtr(6500),
+			},
+			expectedUnsupported: []string{`channel "Shutter": ShutterStrobe`},
+		},
+		{
+			name:         "Emitter without a color model",
+			file:         "testdata/ofl/example/rgbuv-par.json",
+			expectedMode: "4-channel",
+			expectedMapping: ChannelMapping{
+				IntensityTopic: "fx/{id}/intensity", ColorTopic: "fx/{id}/color", OnOffTopic: "fx/{id}/onoff",
+				OutputMax: floatPtr(255), Rounding: RoundingNearest,
+				EmitterTopics: map[string]string{"red": "fx/{id}/red", "green": "fx/{id}/green", "blue": "fx/{id}/blue"},
+			},
+			expectedUnsupported: []string{`channel "UV": uv emitter without a matching color model`},
+		},
+		{
+			name:        "Unknown mode",
+			file:        "testdata/ofl/example/tunable-white-spot.json",
+			mode:        "Wide",
+			expectError: true,
+		},
+		{
+			name:        "Not a fixture",
+			file:        "testdata/ofl/manufacturers.json",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", tt.file, err)
+			}
+			conversion, err := convertOFLFixture(data, "test", "fx/{id}/", tt.mode)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("convertOFLFixture() expected an error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("convertOFLFixture() unexpected error: %v", err)
+			}
+			if conversion.Mode != tt.expectedMode {
+				t.Errorf("Mode got = %q, want %q", conversion.Mode, tt.expectedMode)
+			}
+			if !reflect.DeepEqual(conversion.Profile.ChannelMapping, tt.expectedMapping) {
+				t.Errorf("Mapping got = %+v, want %+v", conversion.Profile.ChannelMapping, tt.expectedMapping)
+			}
+			if !reflect.DeepEqual(conversion.Unsupported, tt.expectedUnsupported) {
+				t.Errorf("Unsupported got = %q, want %q", conversion.Unsupported, tt.expectedUnsupported)
+			}
+		})
+	}
+}
+
+func TestLoadOFLFixtureDirectory(t *testing.T) {
+	profiles, err := loadFixtureProfiles([]string{"testdata/ofl"}, ".", "stage/{id}")
+	if err != nil {
+		t.Fatalf("loadFixtureProfiles() unexpected error: %v", err)
+	}
+
+	// manufacturers.json is not a fixture and must be skipped
+	expected := []string{"example/rgbuv-par", "example/tunable-white-spot", "generic/cmy-fader", "generic/drgbw-fader"}
+	if names := sortedKeys(profiles); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Loaded profiles %v, want %v", names, expected)
+	}
+
+	cm, err := expandChannelMapping(ChannelMapping{ChannelNumber: 7, Profile: "generic/drgbw-fader", ID: "par-1"}, profiles)
+	if err != nil {
+		t.Fatalf("expandChannelMapping() unexpected error: %v", err)
+	}
+	if err := validateChannelMapping(cm); err != nil {
+		t.Errorf("Imported profile is invalid: %v", err)
+	}
+	if cm.IntensityTopic != "stage/par-1/intensity" || cm.EmitterTopics[EmitterWhite] != "stage/par-1/white" {
+		t.Errorf("Unexpected topics for imported fixture: %+v", cm)
+	}
+
+	// The fixture's dimmer gets the intensity, and the emitters the undimmed color, so it isn't dimmed twice
+	mockMQTT := &MockMQTTClient{}
+	httpServer := NewHTTPServer(&Config{ChannelMappings: []ChannelMapping{cm}}, mockMQTT)
+	httpServer.processDataPoints([]IncomingDataPoint{{ChannelNumber: 7, Value: json.Number("50"), Color: "#FF0000"}}, "test")
+	if !containsMessage(mockMQTT.PublishedMessages["stage/par-1/intensity"], "128") {
+		t.Errorf("Expected the dimmer at half on the intensity topic, got %v", mockMQTT.PublishedMessages["stage/par-1/intensity"])
+	}
+	if !containsMessage(mockMQTT.PublishedMessages["stage/par-1/red"], "255") {
+		t.Errorf("Expected an undimmed red emitter, got %v", mockMQTT.PublishedMessages["stage/par-1/red"])
+	}
+}
+
+func TestRunImportOFL(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "spot.yaml")
+	var stdout, stderr bytes.Buffer
+	code := runImportOFL([]string{"-mode", "Basic", "-topic", "dmx/{id}", "-o", output, "testdata/ofl/example/tunable-white-spot.json"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("runImportOFL() exit code %d, stderr: %s", code, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), `Unsupported: channel "Shutter": ShutterStrobe`) {
+		t.Errorf("Expected unsupported capabilities to be reported, got: %s", stderr.String())
+	}
+
+	// The written profile loads like a hand-written one
+	profile, err := loadFixtureProfile(output)
+	if err != nil {
+		t.Fatalf("Converted profile does not load: %v", err)
+	}
+	if profile.Name != "example/tunable-white-spot" || profile.CCTTopic != "dmx/{id}/cct" {
+		t.Errorf("Unexpected converted profile: %+v", profile)
+	}
+	cm, err := expandChannelMapping(ChannelMapping{ChannelNumber: 1, Profile: profile.Name, ID: "spot"}, map[string]FixtureProfile{profile.Name: profile})
+	if err != nil {
+		t.Fatalf("expandChannelMapping() unexpected error: %v", err)
+	}
+	if err := validateChannelMapping(cm); err != nil {
+		t.Errorf("Converted profile is invalid: %v", err)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := runImportOFL([]string{"-name", "drgbw", "testdata/ofl/generic/drgbw-fader.json"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("runImportOFL() exit code %d, stderr: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "name: drgbw\n") || !strings.Contains(stdout.String(), "colorModel: rgbw\n") {
+		t.Errorf("Expected the profile on standard output, got: %s", stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "emitterTopics:\n  blue: ") {
+		t.Errorf("Expected the profile indented by 2 spaces, got: %s", stdout.String())
+	}
+
+	if code := runImportOFL([]string{"testdata/ofl/missing.json"}, &stdout, &stderr); code != 1 {
+		t.Errorf("Expected exit code 1 for a missing file, got %d", code)
+	}
+	if code := runImportOFL(nil, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2 without a file, got %d", code)
+	}
+}
+
+func TestOFLProfileName(t *testing.T) {
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"fixtures/cameo/flat-pro-18.json", "cameo/flat-pro-18"},
+		{"cameo/flat-pro-18.json", "cameo/flat-pro-18"},
+		{"rgbuv-par.json", "rgbuv-par"},
+		{"./rgbuv-par.json", "rgbuv-par"},
+	}
+
+	for _, tt := range tests {
+		if name := oflProfileName(tt.file); name != tt.expected {
+			t.Errorf("oflProfileName(%q) = %q, want %q", tt.file, name, tt.expected)
+		}
+	}
+}
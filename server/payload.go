@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"text/template"
+)
+
+// Default payload templates, matching the bridge's original fixed formats
+const (
+	defaultIntensityPayload = `{{.Intensity}}`              // e.g. "75.500000", or "191" when rounding
+	defaultColorPayload     = `{{.Color}}`                  // In the channel's colorFormat, e.g. "#FF0000"
+	defaultOnOffPayload     = `{{if .On}}1{{else}}0{{end}}` // "1" or "0"
+	defaultCCTPayload       = `{{.CCT}}`                    // In the channel's cctUnit, e.g. "2700"
+)
+
+// PayloadData is what payload templates are executed against
+type PayloadData struct {
+	ChannelNumber int
+	Value         float64 // Intensity as received
+	Scaled        float64 // Intensity after per-channel scaling and rounding
+	Intensity     string  // Scaled, formatted as an integer when rounding is configured, otherwise like "75.500000"
+	Color         string  // Color in the channel's colorFormat; as received, e.g. "#FF8000", if none is set
+	Hex           string  // Color normalized to "#RRGGBB"
+	Red           uint8   // Color components, 0-255
+	Green         uint8
+	Blue          uint8
+	Hue           float64 // HSV hue in degrees, 0-360
+	Saturation    float64 // HSV saturation in percent, 0-100
+	Brightness    float64 // HSV value in percent, 0-100
+	X             float64 // CIE 1931 chromaticity
+	Y             float64
+	Emitters      EmitterLevels // Per-emitter levels for the channel's colorModel, dimmed by the intensity
+	Kelvin        float64       // Color temperature, as received or approximated from Color, clamped to the fixture's range
+	Mired         float64       // Kelvin in mired
+	CCT           string        // Kelvin as an integer in the channel's cctUnit
+	On            bool          // Whether the channel is on: as sent, or else Value > 0
+}
+
+// payloadFuncs are available to every payload template in addition to the text/template builtins
+var payloadFuncs = template.FuncMap{
+	// round converts a float to the nearest integer, e.g. {{round .Scaled}}
+	"round": func(f float64) int64 { return int64(math.Round(f)) },
+	// json encodes any value as JSON, e.g. {"color":{{json .Color}}}
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// samplePayloadData is used to check templates at load time
+var samplePayloadData = PayloadData{ChannelNumber: 1, Value: 75.5, Scaled: 75.5, Intensity: "75.500000", Color: "#FF8000", Hex: "#FF8000",
+	Red: 255, Green: 128, Hue: 30.1, Saturation: 100, Brightness: 100, X: 0.5702, Y: 0.3927,
+	Emitters: EmitterLevels{Red: 192, Green: 96}, Kelvin: 2700, Mired: 370.37, CCT: "2700", On: true}
+
+// parsePayloadTemplate compiles a payload template and executes it once against sample
+// data, so unknown fields and functions are reported at load time rather than mid-show
+func parsePayloadTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("payload").Funcs(payloadFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, samplePayloadData); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// payloadTemplateCache compiles each distinct template text once
+type payloadTemplateCache struct {
+	templates map[string]*template.Template
+	lock      sync.Mutex
+}
+
+func newPayloadTemplateCache() *payloadTemplateCache {
+	return &payloadTemplateCache{templates: make(map[string]*template.Template)}
+}
+
+// render executes the template text against data, compiling and caching it on first use
+func (c *payloadTemplateCache) render(text string, data PayloadData) (string, error) {
+	c.lock.Lock()
+	tmpl, ok := c.templates[text]
+	if !ok {
+		var err error
+		tmpl, err = parsePayloadTemplate(text)
+		if err != nil {
+			c.lock.Unlock()
+			return "", fmt.Errorf("invalid payload template: %w", err)
+		}
+		c.templates[text] = tmpl
+	}
+	c.lock.Unlock()
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render payload template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// payloadTemplateOrDefault returns the configured template, or def if none is set
+func payloadTemplateOrDefault(configured, def string) string {
+	if configured == "" {
+		return def
+	}
+	return configured
+}
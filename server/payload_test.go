@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPayloadTemplates(t *testing.T) {
+	data := PayloadData{ChannelNumber: 3, Value: 75, Scaled: 191.25, Intensity: "191.250000", Color: "#FF8000", Red: 255, Green: 128, Blue: 0, On: true}
+	off := PayloadData{ChannelNumber: 3, Color: "#000000"}
+
+	tests := []struct {
+		name     string
+		template string
+		data     PayloadData
+		expected string
+	}{
+		{name: "Default intensity", template: defaultIntensityPayload, data: data, expected: "191.250000"},
+		{name: "Default color", template: defaultColorPayload, data: data, expected: "#FF8000"},
+		{name: "Default on/off (on)", template: defaultOnOffPayload, data: data, expected: "1"},
+		{name: "Default on/off (off)", template: defaultOnOffPayload, data: off, expected: "0"},
+		{name: "ON/OFF keyword", template: `{{if .On}}ON{{else}}OFF{{end}}`, data: off, expected: "OFF"},
+		{name: "JSON state with rounded brightness", template: `{"state":"{{if .On}}ON{{else}}OFF{{end}}","brightness":{{round .Scaled}}}`, data: data, expected: `{"state":"ON","brightness":191}`},
+		{name: "Color components", template: `{{.Red}},{{.Green}},{{.Blue}}`, data: data, expected: "255,128,0"},
+		{name: "JSON-encoded string", template: `{"channel":{{.ChannelNumber}},"color":{{json .Color}}}`, data: data, expected: `{"channel":3,"color":"#FF8000"}`},
+	}
+
+	cache := newPayloadTemplateCache()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cache.render(tt.template, tt.data)
+			if err != nil {
+				t.Fatalf("render() unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("render() got = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParsePayloadTemplateErrors(t *testing.T) {
+	for _, text := range []string{
+		`{{.Value`,         // Syntax error
+		`{{.Level}}`,       // Unknown field
+		`{{upper .Color}}`, // Unknown function
+	} {
+		if _, err := parsePayloadTemplate(text); err == nil {
+			t.Errorf("parsePayloadTemplate(%q) expected an error, but got nil", text)
+		}
+	}
+}
+
+func TestPublishWithPayloadTemplates(t *testing.T) {
+	cfg := &Config{
+		ChannelMappings: []ChannelMapping{
+			{
+				ChannelNumber:    1,
+				IntensityTopic:   "ch1/intensity",
+				ColorTopic:       "ch1/color",
+				OnOffTopic:       "ch1/onoff",
+				IntensityPayload: `{"brightness":{{round .Value}}}`,
+				OnOffPayload:     `{{if .On}}ON{{else}}OFF{{end}}`,
+			},
+		},
+	}
+	mockMQTT := &MockMQTTClient{}
+	httpServer := NewHTTPServer(cfg, mockMQTT)
+
+	httpServer.processDataPoints([]IncomingDataPoint{{ChannelNumber: 1, Value: json.Number("42.6"), Color: "#00FF00"}}, "test")
+
+	for topic, want := range map[string]string{
+		"ch1/intensity": `{"brightness":43}`,
+		"ch1/color":     "#00FF00", // No template configured, so the default applies
+		"ch1/onoff":     "ON",
+	} {
+		if !containsMessage(mockMQTT.PublishedMessages[topic], want) {
+			t.Errorf("Topic '%s': expected payload '%s', got %v", topic, want, mockMQTT.PublishedMessages[topic])
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateSaveDelay is how long the persister waits after a change before writing the
+// state file, so a fast fade produces one write instead of hundreds
+const stateSaveDelay = 500 * time.Millisecond
+
+// stateFileContents is the on-disk format of the state file
+type stateFileContents struct {
+	SavedAt  time.Time      `json:"savedAt"`
+	Channels []ChannelState `json:"channels"`
+}
+
+// LoadStateFile reads channel states previously written by a StatePersister.
+// A missing file is not an error; it simply yields no states.
+func LoadStateFile(path string) ([]ChannelState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file '%s': %w", path, err)
+	}
+
+	var contents stateFileContents
+	if err := json.Unmarshal(data, &contents); err != nil {
+		return nil, fmt.Errorf("failed to parse state file '%s': %w", path, err)
+	}
+	return contents.Channels, nil
+}
+
+// writeStateFile atomically replaces the state file with a snapshot of states
+func writeStateFile(path string, states []ChannelState) error {
+	data, err := json.MarshalIndent(stateFileContents{SavedAt: time.Now(), Channels: states}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic replaces a file: data is written to a temporary file in the same
+// directory, synced, and renamed over the old one, so a crash mid-write never leaves a
+// truncated file behind. An existing file's permissions are kept.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for '%s': %w", path, err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // No-op once the rename has succeeded
+
+	if info, err := os.Stat(path); err == nil {
+		if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to set permissions of temporary file for '%s': %w", path, err)
+		}
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file for '%s': %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temporary file for '%s': %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file for '%s': %w", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace '%s': %w", path, err)
+	}
+	return nil
+}
+
+// StatePersister writes the StateStore to disk shortly after it changes
+type StatePersister struct {
+	path  string
+	store *StateStore
+	delay time.Duration
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewStatePersister creates a persister that saves store to path, at most once per delay
+func NewStatePersister(path string, store *StateStore, delay time.Duration) *StatePersister {
+	return &StatePersister{
+		path:  path,
+		store: store,
+		delay: delay,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// Start begins watching the store for changes in the background
+func (p *StatePersister) Start() {
+	updates, unsubscribe := p.store.Subscribe()
+	go func() {
+		defer close(p.done)
+		defer func() { unsubscribe() }()
+
+		var timer *time.Timer
+		var timerC <-chan time.Time
+		dirty := false
+
+		for {
+			select {
+			case _, ok := <-updates:
+				if !ok {
+					// Dropped for falling behind; resubscribe and assume we missed something
+					updates, unsubscribe = p.store.Subscribe()
+				}
+				dirty = true
+				if timer == nil {
+					timer = time.NewTimer(p.delay)
+					timerC = timer.C
+				}
+			case <-timerC:
+				timer, timerC = nil, nil
+				p.save()
+				dirty = false
+			case <-p.stop:
+				if timer != nil {
+					timer.Stop()
+				}
+				// Changes may still be buffered if stop won the race against them
+				if len(updates) > 0 {
+					dirty = true
+				}
+				if dirty {
+					p.save()
+				}
+				return
+			}
+		}
+	}()
+}
+
+// Stop writes any pending changes and waits for the background goroutine to exit
+func (p *StatePersister) Stop() {
+	close(p.stop)
+	<-p.done
+}
+
+func (p *StatePersister) save() {
+	if err := writeStateFile(p.path, p.store.All()); err != nil {
+		log.Printf("Failed to save channel state: %v", err)
+	}
+}
+
+// RestoreState loads previously saved channel states into the state store. States for
+// channels that are no longer mapped are skipped. If republish is set, each restored
+// channel is published to its MQTT topics so the rig matches the restored state.
+func (hs *HTTPServer) RestoreState(states []ChannelState, republish bool) {
+	restored := 0
+	for _, state := range states {
+		hs.channelMapLock.RLock()
+		mapping, ok := hs.channelMap[state.ChannelNumber]
+		hs.channelMapLock.RUnlock()
+		if !ok {
+			log.Printf("Skipping saved state for unmapped channelNumber %d", state.ChannelNumber)
+			continue
+		}
+
+		hs.state.Set(state)
+		if republish {
+			hs.publishChannel(mapping, state, allChannelChanges)
+		}
+		restored++
+	}
+	log.Printf("Restored state for %d channels", restored)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStateFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	states, err := LoadStateFile(path)
+	if err != nil || states != nil {
+		t.Fatalf("Expected missing state file to load as empty, got %v, %v", states, err)
+	}
+
+	saved := []ChannelState{
+		{ChannelNumber: 1, Value: 75.5, Color: "#FF0000", On: true, UpdatedAt: time.Date(2025, 1, 1, 20, 0, 0, 0, time.UTC), Source: "post 127.0.0.1:1234"},
+		{ChannelNumber: 2, Value: 0, Color: "#00FF00", On: false, UpdatedAt: time.Date(2025, 1, 1, 20, 0, 1, 0, time.UTC), Source: "ws 127.0.0.1:1235"},
+	}
+	if err := writeStateFile(path, saved); err != nil {
+		t.Fatalf("writeStateFile() error: %v", err)
+	}
+
+	loaded, err := LoadStateFile(path)
+	if err != nil {
+		t.Fatalf("LoadStateFile() error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, saved) {
+		t.Errorf("LoadStateFile() got = %v, want %v", loaded, saved)
+	}
+
+	// Only the state file itself should remain; temporary files are renamed or removed
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the state file in its directory, found %d entries", len(entries))
+	}
+
+	if err := os.WriteFile(path, []byte("{truncated"), 0644); err != nil {
+		t.Fatalf("Failed to corrupt state file: %v", err)
+	}
+	if _, err := LoadStateFile(path); err == nil {
+		t.Error("Expected an error loading a corrupt state file")
+	}
+}
+
+func TestStatePersister(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := NewStateStore()
+	persister := NewStatePersister(path, store, 20*time.Millisecond)
+	persister.Start()
+
+	store.Set(ChannelState{ChannelNumber: 1, Value: 10, Color: "#FFFFFF", On: true})
+	store.Set(ChannelState{ChannelNumber: 1, Value: 20, Color: "#FFFFFF", On: true})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		states, _ := LoadStateFile(path)
+		if len(states) == 1 && states[0].Value == 20 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("State file was not written after a change, last read: %v", states)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	persister.Stop()
+
+	// Stop must flush a change that is still waiting on the debounce timer
+	persister = NewStatePersister(path, store, time.Hour)
+	persister.Start()
+	store.Set(ChannelState{ChannelNumber: 2, Value: 5, Color: "#000000", On: true})
+	persister.Stop()
+
+	states, err := LoadStateFile(path)
+	if err != nil {
+		t.Fatalf("LoadStateFile() error: %v", err)
+	}
+	if len(states) != 2 {
+		t.Errorf("Expected pending change to be flushed on Stop, got %v", states)
+	}
+}
+
+func TestRestoreState(t *testing.T) {
+	cfg := &Config{
+		ChannelMappings: []ChannelMapping{
+			{ChannelNumber: 1, IntensityTopic: "ch1/intensity", ColorTopic: "ch1/color", OnOffTopic: "ch1/onoff"},
+		},
+	}
+	mockMQTT := &MockMQTTClient{}
+	httpServer := NewHTTPServer(cfg, mockMQTT)
+
+	httpServer.RestoreState([]ChannelState{
+		{ChannelNumber: 1, Value: 50, Color: "#0000FF", On: true},
+		{ChannelNumber: 7, Value: 50, Color: "#0000FF", On: true}, // No longer mapped
+	}, true)
+
+	if _, ok := httpServer.state.Get(7); ok {
+		t.Error("Expected state for unmapped channel to be skipped")
+	}
+	if state, ok := httpServer.state.Get(1); !ok || state.Value != 50 {
+		t.Errorf("Expected channel 1 to be restored, got %+v", state)
+	}
+	if !containsMessage(mockMQTT.PublishedMessages["ch1/intensity"], "50.000000") ||
+		!containsMessage(mockMQTT.PublishedMessages["ch1/color"], "#0000FF") ||
+		!containsMessage(mockMQTT.PublishedMessages["ch1/onoff"], "1") {
+		t.Errorf("Expected restored state to be republished, got %v", mockMQTT.PublishedMessages)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FixtureProfile is a reusable fixture definition. It holds any ChannelMapping settings
+// (topics, payloads, ranges, curves, color model, ...) except those identifying a single
+// fixture, such as channelNumber; topics may contain placeholders such as {id}, which are
+// filled in from the channelMappings entry using the profile.
+type FixtureProfile struct {
+	Name           string `yaml:"name"`
+	Description    string `yaml:"description,omitempty"`
+	ChannelMapping `yaml:",inline"`
+}
+
+// loadFixtureProfiles reads the profiles in paths, each a profile file or a directory
+// searched for *.yaml and *.yml profile files. *.json files are imported as Open Fixture
+// Library fixtures, with topics below oflTopicPattern. Relative paths are resolved
+// against baseDir.
+func loadFixtureProfiles(paths []string, baseDir, oflTopicPattern string) (map[string]FixtureProfile, error) {
+	profiles := make(map[string]FixtureProfile)
+	sources := make(map[string]string) // Profile name to the file defining it
+
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		files, err := profileFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			var profile FixtureProfile
+			if strings.EqualFold(filepath.Ext(file), ".json") {
+				profile, err = loadOFLProfile(file, oflTopicPattern)
+			} else {
+				profile, err = loadFixtureProfile(file)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if previous, ok := sources[profile.Name]; ok {
+				return nil, fmt.Errorf("fixture profile %q is defined in both '%s' and '%s'", profile.Name, previous, file)
+			}
+			profiles[profile.Name] = profile
+			sources[profile.Name] = file
+		}
+	}
+	return profiles, nil
+}
+
+// profileFiles lists the profile files at path, which may be a file or a directory.
+// Directories are searched recursively, so a checkout of the Open Fixture Library's
+// fixtures directory, with one subdirectory per manufacturer, can be used as is.
+func profileFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtureProfiles path '%s': %w", path, err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".yaml", ".yml":
+		case ".json":
+			if oflIndexFiles[entry.Name()] {
+				return nil
+			}
+		default:
+			return nil
+		}
+		if !entry.IsDir() {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtureProfiles directory '%s': %w", path, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// loadFixtureProfile reads a single profile file. Unknown fields are rejected, since a
+// misspelt setting would otherwise be silently ignored on every fixture using the profile.
+func loadFixtureProfile(file string) (FixtureProfile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return FixtureProfile{}, fmt.Errorf("failed to read fixture profile '%s': %w", file, err)
+	}
+
+	var profile FixtureProfile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&profile); err != nil && !errors.Is(err, io.EOF) {
+		return FixtureProfile{}, fmt.Errorf("failed to parse fixture profile '%s': %w", file, err)
+	}
+	if profile.Name == "" {
+		return FixtureProfile{}, fmt.Errorf("fixture profile '%s' must have a name", file)
+	}
+	if field := instanceField(data); field != "" {
+		return FixtureProfile{}, fmt.Errorf("fixture profile '%s' sets %s, which can only be set in channelMappings", file, field)
+	}
+	return profile, nil
+}
+
+// profileInstanceFields are the ChannelMapping settings that identify a single fixture,
+// rather than describe a kind of fixture, so they have no place in a profile
+var profileInstanceFields = []string{"channelNumber", "channelRange", "profile", "id"}
+
+// instanceField returns the first of profileInstanceFields set at the top level of a
+// profile file, or "" if there is none. The YAML is looked at rather than the decoded
+// profile, since e.g. channelNumber: 0 decodes to the zero value.
+func instanceField(data []byte) string {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil || len(document.Content) == 0 {
+		return ""
+	}
+	root := document.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		for _, field := range profileInstanceFields {
+			if root.Content[i].Value == field {
+				return field
+			}
+		}
+	}
+	return ""
+}
+
+// placeholderPattern matches placeholders like {id} in topic patterns. Numeric
+// placeholders may be scaled and offset, e.g. {n*3+1} or {n-1}.
+var placeholderPattern = regexp.MustCompile(`\{([A-Za-z][A-Za-z0-9_]*)(\s*\*\s*\d+)?(\s*[+-]\s*\d+)?\}`)
+
+// expandChannelMapping resolves a channelMappings entry into the mapping used at runtime.
+// An entry referencing a profile starts from the profile's settings; any setting given in
+// the entry itself overrides the profile's. Topic placeholders are then filled in: {n}
+// with the channel number, and {id} with the entry's id. Entries without a profile are
+// used as written, so their topics may contain braces; generateChannelMappings has
+// already filled in {n} for those generated from a channelRange.
+func expandChannelMapping(cm ChannelMapping, profiles map[string]FixtureProfile) (ChannelMapping, error) {
+	if cm.Profile == "" {
+		if cm.ID != "" {
+			return cm, fmt.Errorf("has id %q but no profile", cm.ID)
+		}
+		return cm, nil
+	}
+	values := map[string]string{"n": strconv.Itoa(cm.ChannelNumber)}
+
+	profile, ok := profiles[cm.Profile]
+	if !ok {
+		return cm, fmt.Errorf("references unknown fixture profile %q", cm.Profile)
+	}
+
+	expanded := profile.ChannelMapping
+	overlayChannelMapping(&expanded, cm)
+	if cm.ID != "" {
+		values["id"] = cm.ID
+	}
+	if err := expandTopicPlaceholders(&expanded, values); err != nil {
+		return cm, fmt.Errorf("using profile %q %w", cm.Profile, err)
+	}
+	return expanded, nil
+}
+
+// overlayChannelMapping copies every setting that is set in override onto base
+func overlayChannelMapping(base *ChannelMapping, override ChannelMapping) {
+	b := reflect.ValueOf(base).Elem()
+	o := reflect.ValueOf(override)
+	for i := 0; i < o.NumField(); i++ {
+		if field := o.Field(i); !field.IsZero() {
+			b.Field(i).Set(field)
+		}
+	}
+	base.ChannelNumber = override.ChannelNumber
+}
+
+// expandPlaceholders replaces the placeholders in text with values, failing on any
+// placeholder without a value. name identifies text in errors.
+func expandPlaceholders(name string, text *string, values map[string]string) error {
+	var problems []string
+	*text = placeholderPattern.ReplaceAllStringFunc(*text, func(placeholder string) string {
+		match := placeholderPattern.FindStringSubmatch(placeholder)
+		value, ok := values[match[1]]
+		if !ok {
+			problems = append(problems, "unresolved placeholder "+placeholder)
+			return placeholder
+		}
+		value, err := applyPlaceholderOffset(value, match[2], match[3])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid placeholder %s: %v", placeholder, err))
+			return placeholder
+		}
+		return value
+	})
+	if len(problems) > 0 {
+		return fmt.Errorf("has %s in %s '%s'", strings.Join(problems, ", "), name, *text)
+	}
+	return nil
+}
+
+// expandTopicPlaceholders replaces placeholders in every topic of the mapping with values
+func expandTopicPlaceholders(cm *ChannelMapping, values map[string]string) error {
+	expand := func(name string, topic *string) error {
+		return expandPlaceholders(name, topic, values)
+	}
+
+	for _, topic := range []struct {
+		name  string
+		topic *string
+	}{
+		{"intensityTopic", &cm.IntensityTopic},
+		{"colorTopic", &cm.ColorTopic},
+		{"onOffTopic", &cm.OnOffTopic},
+		{"cctTopic", &cm.CCTTopic},
+	} {
+		if err := expand(topic.name, topic.topic); err != nil {
+			return err
+		}
+	}
+
+	if len(cm.EmitterTopics) > 0 {
+		// Copy, since the map may be shared with the profile and other instances
+		emitterTopics := make(map[string]string, len(cm.EmitterTopics))
+		for emitter, topic := range cm.EmitterTopics {
+			if err := expand("emitterTopics."+emitter, &topic); err != nil {
+				return err
+			}
+			emitterTopics[emitter] = topic
+		}
+		cm.EmitterTopics = emitterTopics
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigWithFixtureProfiles(t *testing.T) {
+	tempDir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	write("profiles/wash.yaml", `
+name: wash
+description: RGBW wash light
+intensityTopic: "stage/{id}/dimmer"
+colorTopic: "stage/{id}/color"
+onOffTopic: "stage/{id}/power"
+outputMax: 255
+rounding: round
+curve: square
+colorModel: rgbw
+emitterTopics:
+  white: "stage/{id}/white"
+`)
+	write("profiles/README.txt", "Not a profile")
+	write("extra/spot.yml", `
+name: spot
+intensityTopic: "stage/{id}/dimmer"
+colorTopic: "stage/{id}/color"
+onOffTopic: "stage/{id}/power"
+`)
+
+	configPath := write("config.yaml", `
+mqttBroker: "tcp://localhost:1883"
+fixtureProfiles: [profiles, extra/spot.yml]
+channelMappings:
+  - channelNumber: 1
+    profile: wash
+    id: wash-left
+  - channelNumber: 2
+    profile: wash
+    id: wash-right
+    outputMax: 100
+    onOffTopic: "custom/power"
+  - channelNumber: 3
+    profile: spot
+    id: spot-1
+  - channelNumber: 4
+    intensityTopic: "plain/intensity"
+    colorTopic: "plain/color"
+    onOffTopic: "plain/onoff"
+`)
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+
+	expected := []ChannelMapping{
+		{ChannelNumber: 1, Profile: "wash", ID: "wash-left",
+			IntensityTopic: "stage/wash-left/dimmer", ColorTopic: "stage/wash-left/color", OnOffTopic: "stage/wash-left/power",
+			OutputMax: floatPtr(255), Rounding: RoundingNearest, Curve: CurveSquare, ColorModel: ColorModelRGBW,
+			EmitterTopics: map[string]string{EmitterWhite: "stage/wash-left/white"}},
+		{ChannelNumber: 2, Profile: "wash", ID: "wash-right",
+			IntensityTopic: "stage/wash-right/dimmer", ColorTopic: "stage/wash-right/color", OnOffTopic: "custom/power",
+			OutputMax: floatPtr(100), Rounding: RoundingNearest, Curve: CurveSquare, ColorModel: ColorModelRGBW,
+			EmitterTopics: map[string]string{EmitterWhite: "stage/wash-right/white"}},
+		{ChannelNumber: 3, Profile: "spot", ID: "spot-1",
+			IntensityTopic: "stage/spot-1/dimmer", ColorTopic: "stage/spot-1/color", OnOffTopic: "stage/spot-1/power"},
+		{ChannelNumber: 4, IntensityTopic: "plain/intensity", ColorTopic: "plain/color", OnOffTopic: "plain/onoff"},
+	}
+	if !reflect.DeepEqual(cfg.ChannelMappings, expected) {
+		t.Errorf("LoadConfig() expanded mappings\n got = %+v\nwant = %+v", cfg.ChannelMappings, expected)
+	}
+}
+
+func TestFixtureProfileErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		profiles map[string]string
+		mappings string
+		errorMsg string
+	}{
+		{
+			name:     "Unknown profile",
+			mappings: `[{channelNumber: 1, profile: missing, id: a}]`,
+			errorMsg: `unknown fixture profile "missing"`,
+		},
+		{
+			name:     "Missing id",
+			profiles: map[string]string{"p.yaml": "name: p\nintensityTopic: \"x/{id}/i\"\ncolorTopic: \"x/{id}/c\"\nonOffTopic: \"x/{id}/o\""},
+			mappings: `[{channelNumber: 1, profile: p}]`,
+			errorMsg: "unresolved placeholder {id} in intensityTopic",
+		},
+		{
+			name:     "Unknown placeholder",
+			profiles: map[string]string{"p.yaml": "name: p\nintensityTopic: \"x/{id}/i\"\ncolorTopic: \"x/{id}/c\"\nonOffTopic: \"x/{room}/o\""},
+			mappings: `[{channelNumber: 1, profile: p, id: a}]`,
+			errorMsg: "unresolved placeholder {room} in onOffTopic",
+		},
+		{
+			name:     "Id without a profile",
+			mappings: `[{channelNumber: 1, id: a, intensityTopic: "i", colorTopic: "c", onOffTopic: "o"}]`,
+			errorMsg: "has id",
+		},
+		{
+			name:     "Unknown field in profile",
+			profiles: map[string]string{"p.yaml": "name: p\nintensityTopics: \"x/{id}/i\""},
+			mappings: `[{channelNumber: 1, profile: p, id: a}]`,
+			errorMsg: "field intensityTopics not found",
+		},
+		{
+			name:     "Channel number in profile",
+			profiles: map[string]string{"p.yaml": "name: p\nchannelNumber: 0\nintensityTopic: \"x/{id}/i\"\ncolorTopic: \"x/{id}/c\"\nonOffTopic: \"x/{id}/o\""},
+			mappings: `[{channelNumber: 1, profile: p, id: a}]`,
+			errorMsg: "sets channelNumber, which can only be set in channelMappings",
+		},
+		{
+			name:     "Id in profile",
+			profiles: map[string]string{"p.yaml": "name: p\nid: shared\nintensityTopic: \"x/{id}/i\"\ncolorTopic: \"x/{id}/c\"\nonOffTopic: \"x/{id}/o\""},
+			mappings: `[{channelNumber: 1, profile: p}]`,
+			errorMsg: "sets id",
+		},
+		{
+			name:     "Profile without a name",
+			profiles: map[string]string{"p.yaml": "intensityTopic: \"x/{id}/i\""},
+			mappings: `[{channelNumber: 1, profile: p, id: a}]`,
+			errorMsg: "must have a name",
+		},
+		{
+			name:     "Duplicate profile name",
+			profiles: map[string]string{"a.yaml": "name: p", "b.yaml": "name: p"},
+			mappings: `[{channelNumber: 1, profile: p, id: a}]`,
+			errorMsg: `"p" is defined in both`,
+		},
+		{
+			name:     "Expanded mapping is still validated",
+			profiles: map[string]string{"p.yaml": "name: p\nintensityTopic: \"x/{id}/i\"\ncolorTopic: \"x/{id}/c\""},
+			mappings: `[{channelNumber: 1, profile: p, id: a}]`,
+			errorMsg: "must have intensityTopic, colorTopic, and onOffTopic set",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			profileDir := filepath.Join(tempDir, "profiles")
+			if err := os.Mkdir(profileDir, 0755); err != nil {
+				t.Fatalf("Failed to create profile directory: %v", err)
+			}
+			for name, content := range tt.profiles {
+				if err := os.WriteFile(filepath.Join(profileDir, name), []byte(content), 0644); err != nil {
+					t.Fatalf("Failed to write profile: %v", err)
+				}
+			}
+			configPath := filepath.Join(tempDir, "config.yaml")
+			config := "mqttBroker: \"tcp://localhost:1883\"\nfixtureProfiles: [profiles]\nchannelMappings: " + tt.mappings
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+
+			_, err := LoadConfig(configPath)
+			if err == nil {
+				t.Fatalf("LoadConfig() expected an error containing %q, but got nil", tt.errorMsg)
+			}
+			if !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Errorf("LoadConfig() error = %q, want it to contain %q", err, tt.errorMsg)
+			}
+		})
+	}
+}
+
+func TestBundledFixtureProfiles(t *testing.T) {
+	profiles, err := loadFixtureProfiles([]string{"profiles"}, ".", defaultOFLTopicPattern)
+	if err != nil {
+		t.Fatalf("loadFixtureProfiles() unexpected error: %v", err)
+	}
+	if len(profiles) == 0 {
+		t.Fatal("Expected bundled profiles in the profiles directory")
+	}
+	for name := range profiles {
+		cm, err := expandChannelMapping(ChannelMapping{ChannelNumber: 1, Profile: name, ID: "test"}, profiles)
+		if err != nil {
+			t.Errorf("Profile %s: expandChannelMapping() error: %v", name, err)
+			continue
+		}
+		if err := validateChannelMapping(cm); err != nil {
+			t.Errorf("Profile %s: %v", name, err)
+		}
+	}
+}
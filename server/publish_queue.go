@@ -0,0 +1,102 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+)
+
+// ErrPublishQueued is returned by Publish when the broker is unreachable and the
+// message was queued for delivery on reconnect instead of being sent
+var ErrPublishQueued = errors.New("broker disconnected, message queued for delivery on reconnect")
+
+// queuedMessage is a message waiting in the offline queue
+type queuedMessage struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  interface{}
+}
+
+// publishQueue holds messages published while the broker is disconnected. It keeps
+// only the latest message per topic, ordered by when each topic was last updated, so
+// replaying it reproduces the final state without replaying every intermediate value.
+// When full, the least recently updated topic is dropped to make room.
+type publishQueue struct {
+	limit   int
+	order   *list.List               // Oldest first; each element holds a queuedMessage
+	byTopic map[string]*list.Element // Index into order
+	dropped int                      // Messages discarded because the queue was full
+	lock    sync.Mutex
+}
+
+func newPublishQueue(limit int) *publishQueue {
+	return &publishQueue{
+		limit:   limit,
+		order:   list.New(),
+		byTopic: make(map[string]*list.Element),
+	}
+}
+
+// Push queues msg, replacing any message already queued for the same topic
+func (q *publishQueue) Push(msg queuedMessage) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if element, ok := q.byTopic[msg.topic]; ok {
+		q.order.Remove(element)
+	} else if q.order.Len() >= q.limit {
+		oldest := q.order.Front()
+		delete(q.byTopic, oldest.Value.(queuedMessage).topic)
+		q.order.Remove(oldest)
+		q.dropped++
+	}
+	q.byTopic[msg.topic] = q.order.PushBack(msg)
+}
+
+// Drain removes and returns every queued message, oldest first
+func (q *publishQueue) Drain() []queuedMessage {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	messages := make([]queuedMessage, 0, q.order.Len())
+	for element := q.order.Front(); element != nil; element = element.Next() {
+		messages = append(messages, element.Value.(queuedMessage))
+	}
+	q.order.Init()
+	q.byTopic = make(map[string]*list.Element)
+	return messages
+}
+
+// Requeue puts messages that could not be flushed back at the front of the queue, in
+// order. Topics that were queued again in the meantime keep their newer message.
+func (q *publishQueue) Requeue(messages []queuedMessage) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if _, ok := q.byTopic[msg.topic]; ok {
+			continue
+		}
+		if q.order.Len() >= q.limit {
+			q.dropped++
+			continue
+		}
+		q.byTopic[msg.topic] = q.order.PushFront(msg)
+	}
+}
+
+// Len returns the number of queued messages
+func (q *publishQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.order.Len()
+}
+
+// Dropped returns how many messages have been discarded because the queue was full
+func (q *publishQueue) Dropped() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.dropped
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// queuedTopicsAndPayloads flattens drained messages for easy comparison
+func queuedTopicsAndPayloads(messages []queuedMessage) []string {
+	var flattened []string
+	for _, msg := range messages {
+		flattened = append(flattened, msg.topic+"="+msg.payload.(string))
+	}
+	return flattened
+}
+
+func TestPublishQueue(t *testing.T) {
+	q := newPublishQueue(3)
+
+	q.Push(queuedMessage{topic: "ch1/intensity", payload: "10"})
+	q.Push(queuedMessage{topic: "ch1/color", payload: "#FF0000"})
+	q.Push(queuedMessage{topic: "ch1/intensity", payload: "20"}) // Replaces the first value and moves to the back
+	if q.Len() != 2 {
+		t.Errorf("Expected 2 queued messages after coalescing, got %d", q.Len())
+	}
+
+	q.Push(queuedMessage{topic: "ch2/intensity", payload: "30"})
+	q.Push(queuedMessage{topic: "ch3/intensity", payload: "40"}) // Full: drops ch1/color, the least recently updated
+	if q.Dropped() != 1 {
+		t.Errorf("Expected 1 dropped message, got %d", q.Dropped())
+	}
+
+	got := queuedTopicsAndPayloads(q.Drain())
+	want := []string{"ch1/intensity=20", "ch2/intensity=30", "ch3/intensity=40"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Drain() got = %v, want %v", got, want)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected empty queue after Drain, got %d", q.Len())
+	}
+}
+
+func TestPublishQueueRequeue(t *testing.T) {
+	q := newPublishQueue(10)
+	q.Push(queuedMessage{topic: "a", payload: "1"})
+	q.Push(queuedMessage{topic: "b", payload: "1"})
+	unsent := q.Drain()
+
+	// A newer value for "b" arrives before the unsent messages are put back
+	q.Push(queuedMessage{topic: "b", payload: "2"})
+	q.Requeue(unsent)
+
+	got := queuedTopicsAndPayloads(q.Drain())
+	want := []string{"a=1", "b=2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Drain() after Requeue got = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// configWatchInterval is how often -watch checks the configuration file for changes
+const configWatchInterval = 2 * time.Second
+
+// mqttConnectionChanged reports whether two configurations differ in any setting that is
+// fixed when the MQTT connection is made, so applying next needs a new connection
+func mqttConnectionChanged(old, next *Config) bool {
+	connection := func(c *Config) []interface{} {
+		return []interface{}{
+			c.MQTTBroker, c.MQTTClientID, c.MQTTUsername, c.MQTTPassword, c.MQTTTLS, c.MQTTWill,
+			c.MQTTKeepAliveSeconds, c.MQTTPingTimeoutSeconds, c.MQTTConnectTimeoutSeconds,
+			c.MQTTAutoReconnect, c.MQTTMaxReconnectIntervalSeconds, c.MQTTCleanSession,
+			c.MQTTConnectRetry, c.MQTTConnectRetryIntervalSeconds, c.MQTTOfflineQueue, c.MQTTOfflineQueueSize,
+		}
+	}
+	return !reflect.DeepEqual(connection(old), connection(next))
+}
+
+// Reload swaps in a new configuration while the server keeps running. The channel map
+// and publish settings change together, so no request sees half of each. If the MQTT
+// connection settings changed, connect is called for a new client first, while requests
+// carry on over the old one; should that fail, the running configuration stays in place.
+// Messages the old client queued while disconnected are sent by the new one.
+func (hs *HTTPServer) Reload(cfg *Config, connect func(*Config) (MQTTClientInterface, error)) error {
+	old, _ := hs.current()
+	var client MQTTClientInterface
+	if mqttConnectionChanged(old, cfg) {
+		log.Printf("MQTT connection settings changed, connecting to %s", cfg.MQTTBroker)
+		var err error
+		if client, err = connect(cfg); err != nil {
+			return fmt.Errorf("failed to connect with the new configuration: %w", err)
+		}
+	}
+
+	hs.channelMapLock.Lock()
+	previous := hs.mqttClient
+	if client != nil {
+		// The queued messages are older than anything published from now on, so they go first
+		client.AdoptQueue(previous.TakeQueue())
+		hs.mqttClient = client
+	} else {
+		previous.Reconfigure(cfg)
+	}
+	if cfg.HTTPListenAddr != old.HTTPListenAddr {
+		log.Printf("httpListenAddr changed to %s; still listening on %s until restarted", cfg.HTTPListenAddr, old.HTTPListenAddr)
+	}
+	if cfg.StateFile != old.StateFile {
+		log.Printf("stateFile changed to '%s'; still saving to '%s' until restarted", cfg.StateFile, old.StateFile)
+	}
+	channelMap := newChannelMap(cfg)
+	if lost := hs.lostAPIChannels(channelMap); len(lost) > 0 {
+		log.Printf("WARNING: reload discards the changes made through the API to channels %v, which are not in %s; set apiWriteConfig to keep API changes", lost, configSource(hs.configPath))
+	}
+	hs.apiChannels = nil
+	hs.config = cfg
+	hs.channelMap = channelMap
+	hs.channelMapLock.Unlock()
+
+	if client != nil {
+		// A broker with the same client ID may already have dropped the old connection in
+		// favour of the new one; disconnecting keeps it from reconnecting and taking over
+		previous.Retire(cfg)
+		client.AdoptQueue(previous.TakeQueue()) // Publishes that picked up the old client just before the swap
+	}
+	return nil
+}
+
+// lostAPIChannels lists the channels changed through the API, without being written to
+// the config file, whose mapping differs in channelMap. Callers hold channelMapLock.
+func (hs *HTTPServer) lostAPIChannels(channelMap map[int]ChannelMapping) []int {
+	var lost []int
+	for channelNumber := range hs.apiChannels {
+		current, isMapped := hs.channelMap[channelNumber]
+		next, staysMapped := channelMap[channelNumber]
+		if isMapped != staysMapped || !reflect.DeepEqual(current, next) {
+			lost = append(lost, channelNumber)
+		}
+	}
+	sort.Ints(lost)
+	return lost
+}
+
+// connectForReload connects a client for a reloaded configuration. Unlike at startup, it
+// waits up to mqttConnectTimeoutSeconds for the broker even with mqttConnectRetry, so a
+// mistyped or unreachable broker is reported before the working connection is let go.
+func connectForReload(cfg *Config) (MQTTClientInterface, error) {
+	client, err := NewMQTTClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(cfg.MQTTConnectTimeoutSeconds) * time.Second
+	if !client.WaitConnected(timeout) {
+		client.Disconnect() // Stops the background retries
+		return nil, fmt.Errorf("could not connect to MQTT broker %s within %v", cfg.MQTTBroker, timeout)
+	}
+	return client, nil
+}
+
+// reloadConfig reads the configuration file again, with the same overrides, and applies
+// it to the server. An invalid file is reported and leaves the running configuration in place.
+func reloadConfig(configPath string, overrides []string, hs *HTTPServer, connect func(*Config) (MQTTClientInterface, error)) error {
+	cfg, err := LoadConfig(configPath, overrides...)
+	if err != nil {
+		return fmt.Errorf("keeping the running configuration, %s is invalid: %w", configSource(configPath), err)
+	}
+	if err := hs.Reload(cfg, connect); err != nil {
+		return fmt.Errorf("keeping the running configuration: %w", err)
+	}
+	log.Printf("Configuration reloaded from %s: %d channels mapped", configSource(configPath), len(cfg.ChannelMappings))
+	return nil
+}
+
+// watchConfigFile polls the configuration file and calls changed whenever its size or
+// modification time changes, until stop is closed. Polling also catches editors that
+// save by replacing the file, which file system notifications on the old file miss.
+func watchConfigFile(configPath string, interval time.Duration, stop <-chan struct{}, changed func()) {
+	stat := func() (time.Time, int64) {
+		info, err := os.Stat(configPath)
+		if err != nil {
+			return time.Time{}, -1 // Mid-save or deleted; compare as changed once it's back
+		}
+		return info.ModTime(), info.Size()
+	}
+
+	lastModified, lastSize := stat()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			modified, size := stat()
+			if size < 0 || (modified.Equal(lastModified) && size == lastSize) {
+				continue
+			}
+			lastModified, lastSize = modified, size
+			changed()
+		}
+	}
+}
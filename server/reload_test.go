@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMQTTConnectionChanged(t *testing.T) {
+	base := Config{MQTTBroker: "tcp://localhost:1883", MQTTClientID: "bridge", MQTTUsername: "user", MQTTPassword: "secret", QoS: 0}
+
+	tests := []struct {
+		name     string
+		modify   func(c *Config)
+		expected bool
+	}{
+		{"Unchanged", func(c *Config) {}, false},
+		{"Publish settings only", func(c *Config) { c.QoS = 1; c.Retain = true; c.MQTTConfirmPublish = true }, false},
+		{"Channel mappings only", func(c *Config) { c.ChannelMappings = []ChannelMapping{{ChannelNumber: 1}} }, false},
+		{"Equal will in a new struct", func(c *Config) { c.MQTTWill = &MQTTWillConfig{Topic: "status"} }, true},
+		{"Broker", func(c *Config) { c.MQTTBroker = "tcp://broker:1883" }, true},
+		{"Password", func(c *Config) { c.MQTTPassword = "rotated" }, true},
+		{"Client ID", func(c *Config) { c.MQTTClientID = "other" }, true},
+		{"Keep alive", func(c *Config) { c.MQTTKeepAliveSeconds = 30 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := base
+			tt.modify(&next)
+			if got := mqttConnectionChanged(&base, &next); got != tt.expected {
+				t.Errorf("mqttConnectionChanged() = %t, want %t", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	oldCfg := &Config{
+		MQTTBroker: "tcp://localhost:1883",
+		ChannelMappings: []ChannelMapping{
+			{ChannelNumber: 1, IntensityTopic: "ch1/intensity", ColorTopic: "ch1/color", OnOffTopic: "ch1/onoff"},
+			{ChannelNumber: 2, IntensityTopic: "ch2/intensity", ColorTopic: "ch2/color", OnOffTopic: "ch2/onoff"},
+		},
+	}
+	newMappings := []ChannelMapping{
+		{ChannelNumber: 2, IntensityTopic: "patched/intensity", ColorTopic: "patched/color", OnOffTopic: "patched/onoff"},
+		{ChannelNumber: 3, IntensityTopic: "ch3/intensity", ColorTopic: "ch3/color", OnOffTopic: "ch3/onoff"},
+	}
+	dataPoints := []IncomingDataPoint{
+		{ChannelNumber: 1, Value: json.Number("50"), Color: "#FF0000"},
+		{ChannelNumber: 2, Value: json.Number("50"), Color: "#FF0000"},
+	}
+
+	t.Run("Swaps channel mappings without reconnecting", func(t *testing.T) {
+		mockMQTT := &MockMQTTClient{}
+		httpServer := NewHTTPServer(oldCfg, mockMQTT)
+		newCfg := &Config{MQTTBroker: oldCfg.MQTTBroker, Retain: true, ChannelMappings: newMappings}
+
+		err := httpServer.Reload(newCfg, func(*Config) (MQTTClientInterface, error) {
+			t.Fatal("Reload() connected, but the connection settings are unchanged")
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Reload() unexpected error: %v", err)
+		}
+		if mockMQTT.ReconfiguredWith != newCfg {
+			t.Errorf("Expected the MQTT client to be reconfigured with the new configuration")
+		}
+
+		results := httpServer.processDataPoints(dataPoints, "test")
+		if results[0].Status != DeliveryRejected {
+			t.Errorf("Expected removed channel 1 to be rejected, got %+v", results[0])
+		}
+		if !containsMessage(mockMQTT.PublishedMessages["patched/intensity"], "50.000000") {
+			t.Errorf("Expected channel 2 to publish to its new topic, got %v", mockMQTT.PublishedMessages)
+		}
+		if !mockMQTT.PublishedSettings["patched/intensity"].Retained {
+			t.Errorf("Expected the new global retain setting to apply")
+		}
+	})
+
+	t.Run("Reconnects when the broker changes", func(t *testing.T) {
+		queued := queuedMessage{topic: "ch2/intensity", payload: "25.000000"}
+		oldMQTT := &MockMQTTClient{Queue: []queuedMessage{queued}}
+		httpServer := NewHTTPServer(oldCfg, oldMQTT)
+		newCfg := &Config{MQTTBroker: "tcp://broker.example.com:1883", ChannelMappings: newMappings}
+		newMQTT := &MockMQTTClient{}
+
+		err := httpServer.Reload(newCfg, func(cfg *Config) (MQTTClientInterface, error) {
+			if cfg != newCfg {
+				t.Errorf("Expected to connect with the new configuration")
+			}
+			// Requests carry on over the old client while the new one connects
+			done := make(chan struct{})
+			go func() {
+				httpServer.processDataPoints(dataPoints[:1], "test")
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Errorf("Expected requests not to wait for the new connection")
+			}
+			if oldMQTT.RetiredFor != nil {
+				t.Errorf("Expected the old MQTT client to stay connected until the new one is up")
+			}
+			return newMQTT, nil
+		})
+		if err != nil {
+			t.Fatalf("Reload() unexpected error: %v", err)
+		}
+		if oldMQTT.RetiredFor != newCfg {
+			t.Errorf("Expected the old MQTT client to be retired for the new configuration")
+		}
+		if len(newMQTT.Adopted) != 1 || newMQTT.Adopted[0] != queued {
+			t.Errorf("Expected the old client's queued messages to be handed over, got %v", newMQTT.Adopted)
+		}
+
+		oldMQTT.PublishedMessages = nil
+		httpServer.processDataPoints(dataPoints, "test")
+		if len(oldMQTT.PublishedMessages) != 0 {
+			t.Errorf("Expected nothing published on the old client, got %v", oldMQTT.PublishedMessages)
+		}
+		if !containsMessage(newMQTT.PublishedMessages["patched/intensity"], "50.000000") {
+			t.Errorf("Expected channel 2 to publish on the new client, got %v", newMQTT.PublishedMessages)
+		}
+	})
+
+	t.Run("Keeps the running configuration when connecting fails", func(t *testing.T) {
+		oldMQTT := &MockMQTTClient{}
+		disconnected := false
+		oldMQTT.DisconnectFunc = func() { disconnected = true }
+		httpServer := NewHTTPServer(oldCfg, oldMQTT)
+		newCfg := &Config{MQTTBroker: "tcp://unreachable:1883", ChannelMappings: newMappings}
+
+		err := httpServer.Reload(newCfg, func(cfg *Config) (MQTTClientInterface, error) {
+			return nil, errors.New("connection refused")
+		})
+		if err == nil {
+			t.Fatalf("Reload() expected an error, but got nil")
+		}
+		if disconnected {
+			t.Errorf("Expected the working MQTT connection to be kept")
+		}
+
+		results := httpServer.processDataPoints(dataPoints, "test")
+		if results[0].Status == DeliveryRejected {
+			t.Errorf("Expected channel 1 to stay mapped, got %+v", results[0])
+		}
+		if !containsMessage(oldMQTT.PublishedMessages["ch2/intensity"], "50.000000") {
+			t.Errorf("Expected the old mapping to publish on the old client, got %v", oldMQTT.PublishedMessages)
+		}
+	})
+	t.Run("Notes channels changed through the API that the reload drops", func(t *testing.T) {
+		httpServer := NewHTTPServer(oldCfg, &MockMQTTClient{})
+		for _, mapping := range []ChannelMapping{
+			{ChannelNumber: 1, IntensityTopic: "api/intensity", ColorTopic: "api/color", OnOffTopic: "api/onoff"}, // Not in the new file
+			newMappings[1], // Made the same change in the file
+			{ChannelNumber: 4, IntensityTopic: "ch4/intensity", ColorTopic: "ch4/color", OnOffTopic: "ch4/onoff"}, // Not in the new file
+		} {
+			if _, _, err := httpServer.putChannel(mapping); err != nil {
+				t.Fatalf("putChannel() unexpected error: %v", err)
+			}
+		}
+
+		newCfg := &Config{MQTTBroker: oldCfg.MQTTBroker, ChannelMappings: newMappings}
+		if lost := httpServer.lostAPIChannels(newChannelMap(newCfg)); !reflect.DeepEqual(lost, []int{1, 4}) {
+			t.Errorf("Expected the reload to drop the API changes to channels [1 4], got %v", lost)
+		}
+		if err := httpServer.Reload(newCfg, nil); err != nil {
+			t.Fatalf("Reload() unexpected error: %v", err)
+		}
+		if len(httpServer.apiChannels) != 0 {
+			t.Errorf("Expected the API changes to be forgotten after the reload, got %v", httpServer.apiChannels)
+		}
+		if len(oldCfg.ChannelMappings) != 2 {
+			t.Errorf("Expected the API changes to leave the original configuration alone, got %+v", oldCfg.ChannelMappings)
+		}
+	})
+}
+
+func TestConnectForReloadWaitsForTheBroker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a port: %v", err)
+	}
+	broker := "tcp://" + listener.Addr().String()
+	listener.Close() // Nothing listens there now
+
+	cfg := &Config{MQTTBroker: broker, ChannelMappings: []ChannelMapping{{ChannelNumber: 1, IntensityTopic: "i", ColorTopic: "c", OnOffTopic: "o"}}}
+	cfg.MQTTConnectTimeoutSeconds = 1
+	if err := applyMQTTTuningDefaults(cfg); err != nil {
+		t.Fatalf("applyMQTTTuningDefaults() unexpected error: %v", err)
+	}
+	if !*cfg.MQTTConnectRetry {
+		t.Fatalf("Expected mqttConnectRetry to default to true")
+	}
+
+	start := time.Now()
+	if _, err := connectForReload(cfg); err == nil {
+		t.Fatalf("connectForReload() expected an error for an unreachable broker, but got nil")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("connectForReload() took %v, expected it to give up after the connect timeout", elapsed)
+	}
+}
+
+func TestReloadConfigKeepsRunningConfigWhenInvalid(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(content string) {
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+	}
+	writeConfig(`
+mqttBroker: "tcp://localhost:1883"
+channelMappings: [{channelNumber: 1, intensityTopic: "ch1/intensity", colorTopic: "ch1/color", onOffTopic: "ch1/onoff"}]`)
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	mockMQTT := &MockMQTTClient{}
+	httpServer := NewHTTPServer(cfg, mockMQTT)
+	connect := func(*Config) (MQTTClientInterface, error) { return &MockMQTTClient{}, nil }
+
+	writeConfig(`
+mqttBroker: "tcp://localhost:1883"
+channelMappings: [{channelNumber: 1, intensityTopic: "ch1/intensity", colorTopic: "ch1/+", onOffTopic: "ch1/onoff"}]`)
+	if err := reloadConfig(configPath, nil, httpServer, connect); err == nil {
+		t.Fatalf("reloadConfig() expected an error for an invalid file, but got nil")
+	}
+	if running, _ := httpServer.current(); running != cfg {
+		t.Errorf("Expected the running configuration to stay in place")
+	}
+
+	writeConfig(`
+mqttBroker: "tcp://localhost:1883"
+channelMappings: [{channelNumber: 1, intensityTopic: "ch1/dimmer", colorTopic: "ch1/color", onOffTopic: "ch1/onoff"}]`)
+	if err := reloadConfig(configPath, nil, httpServer, connect); err != nil {
+		t.Fatalf("reloadConfig() unexpected error: %v", err)
+	}
+	httpServer.processDataPoints([]IncomingDataPoint{{ChannelNumber: 1, Value: json.Number("75"), Color: "#FFFFFF"}}, "test")
+	if !containsMessage(mockMQTT.PublishedMessages["ch1/dimmer"], "75.000000") {
+		t.Errorf("Expected the reloaded topic to be used, got %v", mockMQTT.PublishedMessages)
+	}
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte("mqttBroker: tcp://localhost:1883\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	changed := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go watchConfigFile(configPath, 10*time.Millisecond, stop, func() { changed <- struct{}{} })
+
+	select {
+	case <-changed:
+		t.Fatalf("watchConfigFile() reported a change before the file changed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(configPath, []byte("mqttBroker: tcp://broker.example.com:1883\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Errorf("watchConfigFile() did not report the change")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Default input range of IncomingDataPoint.Value, matching the lightboard faders
+const (
+	defaultInputMin = 0.0
+	defaultInputMax = 100.0
+)
+
+// Rounding modes for scaled values
+const (
+	RoundingNone     = ""
+	RoundingNearest  = "round"
+	RoundingFloor    = "floor"
+	RoundingCeil     = "ceil"
+	RoundingTruncate = "truncate"
+)
+
+// valueScale maps an incoming value from the channel's input range to its output range
+type valueScale struct {
+	inMin, inMax   float64
+	outMin, outMax float64
+	rounding       string
+	clamp          bool
+	curve          dimmerCurve
+}
+
+// scaling resolves the mapping's range settings, applying defaults. Without any range
+// settings the scale is the identity and values pass through unclamped, as they always have.
+func (cm ChannelMapping) scaling() valueScale {
+	rangeConfigured := cm.InputMin != nil || cm.InputMax != nil || cm.OutputMin != nil || cm.OutputMax != nil
+	s := valueScale{inMin: defaultInputMin, inMax: defaultInputMax, rounding: cm.Rounding, clamp: rangeConfigured, curve: cm.curve()}
+	if cm.InputMin != nil {
+		s.inMin = *cm.InputMin
+	}
+	if cm.InputMax != nil {
+		s.inMax = *cm.InputMax
+	}
+	s.outMin, s.outMax = s.inMin, s.inMax // Output range defaults to the input range
+	if cm.OutputMin != nil {
+		s.outMin = *cm.OutputMin
+	}
+	if cm.OutputMax != nil {
+		s.outMax = *cm.OutputMax
+	}
+	if cm.Clamp != nil {
+		s.clamp = *cm.Clamp
+	}
+	return s
+}
+
+// validate checks that the ranges are usable
+func (s valueScale) validate() error {
+	for _, bound := range []float64{s.inMin, s.inMax, s.outMin, s.outMax} {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return fmt.Errorf("has a non-finite inputMin/inputMax/outputMin/outputMax")
+		}
+	}
+	if s.inMin == s.inMax {
+		return fmt.Errorf("has an empty input range: inputMin and inputMax are both %v", s.inMin)
+	}
+	if s.outMin == s.outMax {
+		return fmt.Errorf("has an empty output range: outputMin and outputMax are both %v", s.outMin)
+	}
+	switch s.rounding {
+	case RoundingNone, RoundingNearest, RoundingFloor, RoundingCeil, RoundingTruncate:
+	default:
+		return fmt.Errorf("has invalid rounding %q: must be one of round, floor, ceil or truncate", s.rounding)
+	}
+	return s.curve.validate()
+}
+
+// normalize converts a value in the input range to 0-1, clamping if enabled
+func (s valueScale) normalize(value float64) float64 {
+	n := (value - s.inMin) / (s.inMax - s.inMin)
+	if s.clamp {
+		n = math.Max(0, math.Min(1, n))
+	}
+	return n
+}
+
+// denormalize converts a 0-1 level to the output range and applies rounding
+func (s valueScale) denormalize(n float64) float64 {
+	out := s.outMin + n*(s.outMax-s.outMin)
+	switch s.rounding {
+	case RoundingNearest:
+		out = math.Round(out)
+	case RoundingFloor:
+		out = math.Floor(out)
+	case RoundingCeil:
+		out = math.Ceil(out)
+	case RoundingTruncate:
+		out = math.Trunc(out)
+	}
+	return out
+}
+
+// level is the value's position in the input range after the dimmer curve, always within 0-1.
+// It is used to dim quantities that have their own range, such as emitter levels.
+func (s valueScale) level(value float64) float64 {
+	return math.Max(0, math.Min(1, s.curve.apply(s.normalize(value))))
+}
+
+// apply maps a value from the input range through the dimmer curve to the output range
+func (s valueScale) apply(value float64) float64 {
+	return s.denormalize(s.curve.apply(s.normalize(value)))
+}
+
+// format renders a scaled value: as an integer when a rounding mode is set, otherwise
+// with six decimals like the bridge's original intensity payload (e.g. "75.500000")
+func (s valueScale) format(scaled float64) string {
+	if s.rounding != RoundingNone {
+		return strconv.FormatFloat(scaled, 'f', 0, 64)
+	}
+	return fmt.Sprintf("%f", scaled)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func floatPtr(f float64) *float64 { return &f }
+
+func TestValueScale(t *testing.T) {
+	tests := []struct {
+		name      string
+		mapping   ChannelMapping
+		value     float64
+		expected  float64
+		formatted string
+	}{
+		{name: "No settings is the identity", mapping: ChannelMapping{}, value: 75.5, expected: 75.5, formatted: "75.500000"},
+		{name: "No settings does not clamp", mapping: ChannelMapping{}, value: 150, expected: 150, formatted: "150.000000"},
+		{name: "0-100 to 0-255", mapping: ChannelMapping{OutputMax: floatPtr(255)}, value: 75, expected: 191.25, formatted: "191.250000"},
+		{name: "0-100 to 0-255 rounded", mapping: ChannelMapping{OutputMax: floatPtr(255), Rounding: RoundingNearest}, value: 75, expected: 191, formatted: "191"},
+		{name: "Floor", mapping: ChannelMapping{OutputMax: floatPtr(255), Rounding: RoundingFloor}, value: 99.9, expected: 254, formatted: "254"},
+		{name: "Ceil", mapping: ChannelMapping{OutputMax: floatPtr(255), Rounding: RoundingCeil}, value: 0.1, expected: 1, formatted: "1"},
+		{name: "Truncate", mapping: ChannelMapping{OutputMin: floatPtr(-10), OutputMax: floatPtr(10), Rounding: RoundingTruncate}, value: 26, expected: -4, formatted: "-4"},
+		{name: "0-100 to 0-1", mapping: ChannelMapping{OutputMax: floatPtr(1)}, value: 25, expected: 0.25, formatted: "0.250000"},
+		{name: "Custom input range", mapping: ChannelMapping{InputMax: floatPtr(1), OutputMax: floatPtr(1000)}, value: 0.5, expected: 500, formatted: "500.000000"},
+		{name: "Inverted output", mapping: ChannelMapping{OutputMin: floatPtr(255), OutputMax: floatPtr(0)}, value: 100, expected: 0, formatted: "0.000000"},
+		{name: "Clamped above range", mapping: ChannelMapping{OutputMax: floatPtr(255)}, value: 120, expected: 255, formatted: "255.000000"},
+		{name: "Clamped below range", mapping: ChannelMapping{OutputMax: floatPtr(255)}, value: -5, expected: 0, formatted: "0.000000"},
+		{name: "Clamping disabled", mapping: ChannelMapping{OutputMax: floatPtr(200), Clamp: boolPtr(false)}, value: 150, expected: 300, formatted: "300.000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scale := tt.mapping.scaling()
+			if err := scale.validate(); err != nil {
+				t.Fatalf("validate() unexpected error: %v", err)
+			}
+			got := scale.apply(tt.value)
+			if got != tt.expected {
+				t.Errorf("apply(%v) got = %v, want %v", tt.value, got, tt.expected)
+			}
+			if formatted := scale.format(got); formatted != tt.formatted {
+				t.Errorf("format(%v) got = %q, want %q", got, formatted, tt.formatted)
+			}
+		})
+	}
+}
+
+func TestValueScaleValidation(t *testing.T) {
+	for name, mapping := range map[string]ChannelMapping{
+		"Empty input range":  {InputMin: floatPtr(5), InputMax: floatPtr(5)},
+		"Empty output range": {OutputMin: floatPtr(100), OutputMax: floatPtr(100)},
+		"Unknown rounding":   {Rounding: "bankers"},
+	} {
+		if err := mapping.scaling().validate(); err == nil {
+			t.Errorf("%s: validate() expected an error, but got nil", name)
+		}
+	}
+}
+
+func TestPublishScaledIntensity(t *testing.T) {
+	cfg := &Config{
+		ChannelMappings: []ChannelMapping{
+			{ChannelNumber: 1, IntensityTopic: "ch1/intensity", ColorTopic: "ch1/color", OnOffTopic: "ch1/onoff",
+				OutputMax: floatPtr(255), Rounding: RoundingNearest},
+		},
+	}
+	mockMQTT := &MockMQTTClient{}
+	httpServer := NewHTTPServer(cfg, mockMQTT)
+
+	httpServer.processDataPoints([]IncomingDataPoint{{ChannelNumber: 1, Value: json.Number("50"), Color: "#FFFFFF"}}, "test")
+
+	if !containsMessage(mockMQTT.PublishedMessages["ch1/intensity"], "128") {
+		t.Errorf("Expected scaled intensity '128', got %v", mockMQTT.PublishedMessages["ch1/intensity"])
+	}
+}
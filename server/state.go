@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ChannelState is the last known output of a single channel
+type ChannelState struct {
+	ChannelNumber int       `json:"channelNumber"`
+	Value         float64   `json:"value"`
+	Color         string    `json:"color"`
+	Kelvin        float64   `json:"kelvin,omitempty"` // Color temperature, if the client sent one
+	On            bool      `json:"on"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	Source        string    `json:"source"` // Client that caused the last update, e.g. "post 10.0.0.5:51234"
+}
+
+// stateSubscriberBuffer is how many unread changes a subscriber may fall behind by
+// before it is dropped
+const stateSubscriberBuffer = 64
+
+// StateStore keeps the last accepted state of every channel in memory
+// and notifies subscribers whenever a channel's output changes
+type StateStore struct {
+	channels    map[int]ChannelState
+	subscribers map[chan ChannelState]struct{}
+	lock        sync.RWMutex
+}
+
+// NewStateStore creates an empty StateStore
+func NewStateStore() *StateStore {
+	return &StateStore{
+		channels:    make(map[int]ChannelState),
+		subscribers: make(map[chan ChannelState]struct{}),
+	}
+}
+
+// Set records the new state of a channel, replacing whatever was there before.
+// If the value, color or on/off state differ from the previous state (or the channel
+// is new), the change is sent to all subscribers and Set returns true.
+func (s *StateStore) Set(state ChannelState) bool {
+	_, changed := s.Update(state.ChannelNumber, func(ChannelState) ChannelState { return state })
+	return changed
+}
+
+// Update replaces a channel's state with merge's result, computed from the previous
+// state (the zero ChannelState for a new channel) while no other update can interleave,
+// so partial updates from different clients don't overwrite each other. It returns the
+// new state and, like Set, whether subscribers were notified of a change.
+func (s *StateStore) Update(channelNumber int, merge func(previous ChannelState) ChannelState) (ChannelState, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	previous, existed := s.channels[channelNumber]
+	if !existed {
+		previous = ChannelState{ChannelNumber: channelNumber}
+	}
+	state := merge(previous)
+	s.channels[channelNumber] = state
+	if existed && previous.Value == state.Value && previous.Color == state.Color && previous.Kelvin == state.Kelvin && previous.On == state.On {
+		return state, false
+	}
+
+	for ch := range s.subscribers {
+		select {
+		case ch <- state:
+		default:
+			// The subscriber isn't keeping up. Closing its channel ends its stream, and the
+			// client can resync from /state instead of silently missing updates.
+			log.Printf("State subscriber fell %d changes behind, dropping it", stateSubscriberBuffer)
+			close(ch)
+			delete(s.subscribers, ch)
+		}
+	}
+	return state, true
+}
+
+// Subscribe returns a channel that receives every state change, and a function that
+// must be called to unsubscribe. The channel is closed on unsubscribe, or early if
+// the subscriber falls too far behind.
+func (s *StateStore) Subscribe() (<-chan ChannelState, func()) {
+	ch := make(chan ChannelState, stateSubscriberBuffer)
+	s.lock.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.lock.Unlock()
+
+	unsubscribe := func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if _, ok := s.subscribers[ch]; ok {
+			close(ch)
+			delete(s.subscribers, ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// Get returns the state of a single channel and whether any state has been recorded for it
+func (s *StateStore) Get(channelNumber int) (ChannelState, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	state, ok := s.channels[channelNumber]
+	return state, ok
+}
+
+// All returns a snapshot of every recorded channel, ordered by channel number
+func (s *StateStore) All() []ChannelState {
+	s.lock.RLock()
+	states := make([]ChannelState, 0, len(s.channels))
+	for _, state := range s.channels {
+		states = append(states, state)
+	}
+	s.lock.RUnlock()
+
+	sort.Slice(states, func(i, j int) bool { return states[i].ChannelNumber < states[j].ChannelNumber })
+	return states
+}
+
+// requestSource describes the client behind a request for ChannelState.Source
+func requestSource(transport string, r *http.Request) string {
+	return fmt.Sprintf("%s %s", transport, r.RemoteAddr)
+}
+
+// handleStateRequest serves GET /state with the state of every channel seen so far
+func (hs *HTTPServer) handleStateRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is accepted", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, hs.state.All())
+}
+
+// handleChannelStateRequest serves GET /state/{channelNumber}
+func (hs *HTTPServer) handleChannelStateRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is accepted", http.StatusMethodNotAllowed)
+		return
+	}
+
+	channelNumber, err := strconv.Atoi(r.PathValue("channelNumber"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid channelNumber: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	state, ok := hs.state.Get(channelNumber)
+	if !ok {
+		http.Error(w, fmt.Sprintf("No state recorded for channelNumber: %d", channelNumber), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+// writeJSON encodes v as the JSON response body with the given status code
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
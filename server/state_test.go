@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStateEndpoints(t *testing.T) {
+	cfg := &Config{
+		HTTPListenAddr: ":8080",
+		ChannelMappings: []ChannelMapping{
+			{ChannelNumber: 1, IntensityTopic: "ch1/intensity", ColorTopic: "ch1/color", OnOffTopic: "ch1/onoff"},
+			{ChannelNumber: 2, IntensityTopic: "ch2/intensity", ColorTopic: "ch2/color", OnOffTopic: "ch2/onoff"},
+			{ChannelNumber: 3, IntensityTopic: "ch3/intensity", ColorTopic: "ch3/color", OnOffTopic: "ch3/onoff"},
+		},
+	}
+	httpServer := NewHTTPServer(cfg, &MockMQTTClient{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/post", corsMiddleware(httpServer.handleDataRequest))
+	mux.HandleFunc("/state", corsMiddlewareWithMethods("GET, OPTIONS", httpServer.handleStateRequest))
+	mux.HandleFunc("/state/{channelNumber}", corsMiddlewareWithMethods("GET, OPTIONS", httpServer.handleChannelStateRequest))
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	// Nothing has been posted yet
+	resp, err := http.Get(testServer.URL + "/state")
+	if err != nil {
+		t.Fatalf("Failed to GET /state: %v", err)
+	}
+	var states []ChannelState
+	if err := json.NewDecoder(resp.Body).Decode(&states); err != nil {
+		t.Fatalf("Failed to decode /state response: %v", err)
+	}
+	resp.Body.Close()
+	if len(states) != 0 {
+		t.Errorf("Expected empty state before any POST, got %v", states)
+	}
+
+	// Channel 99 is unmapped and must not be recorded
+	body := `[{"channelNumber":2,"value":0,"color":"#00FF00"},{"channelNumber":1,"value":55.5,"color":"#FF0000"},{"channelNumber":99,"value":10,"color":"#FFFFFF"}]`
+	resp, err = http.Post(testServer.URL+"/post", "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("Failed to POST: %v", err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Get(testServer.URL + "/state")
+	if err != nil {
+		t.Fatalf("Failed to GET /state: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %s", ct)
+	}
+	states = nil
+	if err := json.NewDecoder(resp.Body).Decode(&states); err != nil {
+		t.Fatalf("Failed to decode /state response: %v", err)
+	}
+	resp.Body.Close()
+	if len(states) != 2 {
+		t.Fatalf("Expected 2 channel states, got %d: %v", len(states), states)
+	}
+	if states[0].ChannelNumber != 1 || states[1].ChannelNumber != 2 {
+		t.Errorf("Expected states ordered by channel number, got %v", states)
+	}
+	if states[0].Value != 55.5 || states[0].Color != "#FF0000" || !states[0].On {
+		t.Errorf("Unexpected state for channel 1: %+v", states[0])
+	}
+	if states[1].On {
+		t.Errorf("Expected channel 2 to be off, got %+v", states[1])
+	}
+	if states[0].Source == "" || states[0].UpdatedAt.IsZero() {
+		t.Errorf("Expected source and timestamp to be set, got %+v", states[0])
+	}
+
+	tests := []struct {
+		name               string
+		method             string
+		path               string
+		expectedStatusCode int
+		expectedValue      float64
+	}{
+		{name: "Known channel", method: http.MethodGet, path: "/state/1", expectedStatusCode: http.StatusOK, expectedValue: 55.5},
+		{name: "Mapped channel without state", method: http.MethodGet, path: "/state/3", expectedStatusCode: http.StatusNotFound},
+		{name: "Non-numeric channel", method: http.MethodGet, path: "/state/abc", expectedStatusCode: http.StatusBadRequest},
+		{name: "Wrong method", method: http.MethodPost, path: "/state", expectedStatusCode: http.StatusMethodNotAllowed},
+		{name: "Preflight", method: http.MethodOptions, path: "/state/1", expectedStatusCode: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, testServer.URL+tt.path, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatusCode {
+				t.Errorf("Expected status code %d, got %d", tt.expectedStatusCode, resp.StatusCode)
+			}
+			if methods := resp.Header.Get("Access-Control-Allow-Methods"); methods != "GET, OPTIONS" {
+				t.Errorf("Expected Access-Control-Allow-Methods to be %q, got %q", "GET, OPTIONS", methods)
+			}
+			if tt.expectedStatusCode == http.StatusOK {
+				var state ChannelState
+				if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if state.Value != tt.expectedValue {
+					t.Errorf("Expected value %v, got %v", tt.expectedValue, state.Value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsMaxMessageSize caps the size of a single incoming frame (a JSON array of data points)
+	wsMaxMessageSize = 1 << 20
+	// wsWriteTimeout bounds how long we wait to send an acknowledgement to a slow client
+	wsWriteTimeout = 5 * time.Second
+)
+
+// wsUpgrader upgrades /ws requests. Origins are not checked, mirroring the permissive
+// CORS policy applied to /post.
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// WSAck is sent back to the client for every frame received on /ws
+type WSAck struct {
+	Status    string            `json:"status"`            // "ok" or "error"
+	Processed int               `json:"processed"`         // Number of data points that passed validation
+	Errors    []string          `json:"errors,omitempty"`  // Validation and publish errors, if any
+	Results   []DataPointResult `json:"results,omitempty"` // Delivery status of each data point in the frame
+}
+
+// handleWebSocket upgrades the connection and processes each incoming frame as a
+// JSON array of IncomingDataPoint, exactly like a POST body to /post. A WSAck is
+// written back for every frame, so one long-lived connection can replace a stream
+// of individual POST requests.
+func (hs *HTTPServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client with an HTTP error
+		log.Printf("WebSocket upgrade failed for %s: %v", r.RemoteAddr, err)
+		return
+	}
+	conn.SetReadLimit(wsMaxMessageSize)
+
+	hs.trackWebSocket(conn, true)
+	defer func() {
+		hs.trackWebSocket(conn, false)
+		conn.Close()
+	}()
+	log.Printf("WebSocket client connected from %s", r.RemoteAddr)
+	source := requestSource("ws", r)
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("WebSocket read error from %s: %v", r.RemoteAddr, err)
+			}
+			break
+		}
+		if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+			continue
+		}
+
+		ack := hs.handleWebSocketFrame(data, source)
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := conn.WriteJSON(ack); err != nil {
+			log.Printf("WebSocket write error to %s: %v", r.RemoteAddr, err)
+			break
+		}
+	}
+	log.Printf("WebSocket client %s disconnected", r.RemoteAddr)
+}
+
+// handleWebSocketFrame decodes and processes a single frame, returning its acknowledgement
+func (hs *HTTPServer) handleWebSocketFrame(data []byte, source string) WSAck {
+	var dataPoints []IncomingDataPoint
+	if err := json.Unmarshal(data, &dataPoints); err != nil {
+		log.Printf("Error decoding WebSocket frame: %v", err)
+		return WSAck{Status: "error", Errors: []string{fmt.Sprintf("Invalid JSON payload: %v", err)}}
+	}
+	if len(dataPoints) == 0 {
+		log.Println("Received empty data array over WebSocket")
+		return WSAck{Status: "error", Errors: []string{"Received empty data array"}}
+	}
+
+	results := hs.processDataPoints(dataPoints, source)
+	summary, allErrors := summarizeResults(results)
+	if len(allErrors) > 0 {
+		return WSAck{Status: "error", Processed: summary.Processed, Errors: allErrors, Results: results}
+	}
+	return WSAck{Status: "ok", Processed: summary.Processed, Results: results}
+}
+
+// trackWebSocket adds or removes a connection from the set closed on shutdown
+func (hs *HTTPServer) trackWebSocket(conn *websocket.Conn, add bool) {
+	hs.wsConnsLock.Lock()
+	defer hs.wsConnsLock.Unlock()
+	if add {
+		hs.wsConns[conn] = struct{}{}
+	} else {
+		delete(hs.wsConns, conn)
+	}
+}
+
+// closeWebSockets sends a close frame to every open WebSocket. http.Server.Shutdown
+// does not wait for hijacked connections, so this is registered via RegisterOnShutdown.
+func (hs *HTTPServer) closeWebSockets() {
+	hs.wsConnsLock.Lock()
+	defer hs.wsConnsLock.Unlock()
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for conn := range hs.wsConns {
+		conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		conn.Close()
+	}
+}
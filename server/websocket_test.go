@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHandleWebSocket(t *testing.T) {
+	cfg := &Config{
+		HTTPListenAddr: ":8080",
+		ChannelMappings: []ChannelMapping{
+			{ChannelNumber: 1, IntensityTopic: "ch1/intensity", ColorTopic: "ch1/color", OnOffTopic: "ch1/onoff"},
+		},
+	}
+	mockMQTT := &MockMQTTClient{}
+	httpServer := NewHTTPServer(cfg, mockMQTT)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", httpServer.handleWebSocket)
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(testServer.URL, "http") + "/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial WebSocket: %v", err)
+	}
+	defer conn.Close()
+
+	tests := []struct {
+		name              string
+		frame             string
+		expectedStatus    string
+		expectedProcessed int
+		expectErrors      bool
+		expectedMessages  map[string]string // topic -> last payload
+	}{
+		{
+			name:              "Valid frame",
+			frame:             `[{"channelNumber":1,"value":42,"color":"#FF0000"}]`,
+			expectedStatus:    "ok",
+			expectedProcessed: 1,
+			expectedMessages: map[string]string{
+				"ch1/intensity": "42.000000",
+				"ch1/color":     "#FF0000",
+				"ch1/onoff":     "1",
+			},
+		},
+		{
+			name:              "Unknown channel",
+			frame:             `[{"channelNumber":1,"value":0,"color":"#00FF00"},{"channelNumber":99,"value":1,"color":"#000000"}]`,
+			expectedStatus:    "error",
+			expectedProcessed: 1,
+			expectErrors:      true,
+			expectedMessages: map[string]string{
+				"ch1/intensity": "0.000000",
+				"ch1/onoff":     "0",
+			},
+		},
+		{
+			name:           "Malformed JSON",
+			frame:          `{not json`,
+			expectedStatus: "error",
+			expectErrors:   true,
+		},
+		{
+			name:           "Empty array",
+			frame:          `[]`,
+			expectedStatus: "error",
+			expectErrors:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMQTT.PublishedMessages = make(map[string][]string) // Reset mock
+
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(tt.frame)); err != nil {
+				t.Fatalf("Failed to write frame: %v", err)
+			}
+			var ack WSAck
+			if err := conn.ReadJSON(&ack); err != nil {
+				t.Fatalf("Failed to read ack: %v", err)
+			}
+
+			if ack.Status != tt.expectedStatus {
+				t.Errorf("Expected status %q, got %q (errors: %v)", tt.expectedStatus, ack.Status, ack.Errors)
+			}
+			if ack.Processed != tt.expectedProcessed {
+				t.Errorf("Expected %d processed, got %d", tt.expectedProcessed, ack.Processed)
+			}
+			if tt.expectErrors != (len(ack.Errors) > 0) {
+				t.Errorf("Expected errors: %v, got: %v", tt.expectErrors, ack.Errors)
+			}
+			for topic, payload := range tt.expectedMessages {
+				if !containsMessage(mockMQTT.PublishedMessages[topic], payload) {
+					t.Errorf("Topic '%s': expected payload '%s', got %v", topic, payload, mockMQTT.PublishedMessages[topic])
+				}
+			}
+		})
+	}
+}